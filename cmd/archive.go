@@ -0,0 +1,247 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"maze/cmd/ux"
+)
+
+// Name of the manifest stored as the first entry of the upload archive.
+const manifestName = "maze-manifest.json"
+
+var uploadMode string
+
+// Describes the contents of an upload archive so both sides can check that
+// nothing was lost or changed on the way.
+type uploadManifest struct {
+	RootPath string          `json:"rootPath"`
+	PlanPath string          `json:"planPath,omitempty"`
+	IaC      string          `json:"iac"`
+	VarFiles []string        `json:"varFiles,omitempty"`
+	Files    []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Response of the archive upload endpoint.
+type archiveResponse struct {
+	Path     string         `json:"path"`
+	Manifest uploadManifest `json:"manifest"`
+}
+
+// buildManifest hashes every collected file.
+func buildManifest(collection fileCollection) (manifest uploadManifest, err error) {
+	manifest.RootPath = filepath.ToSlash(collection.rootPath)
+	manifest.PlanPath = filepath.ToSlash(collection.planPath)
+	manifest.IaC = collection.iac
+	for _, varFile := range collection.varFiles {
+		manifest.VarFiles = append(manifest.VarFiles, filepath.ToSlash(varFile))
+	}
+	for _, file := range collection.files {
+		entry, err := hashFile(file)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	return manifest, nil
+}
+
+func hashFile(file collectedFile) (entry manifestEntry, err error) {
+	fileToHash, err := file.open()
+	if err != nil {
+		return entry, fmt.Errorf("failed to open file %s: %v", file.path, err)
+	}
+	defer fileToHash.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, fileToHash)
+	if err != nil {
+		return entry, fmt.Errorf("failed to read file %s: %v", file.path, err)
+	}
+	return manifestEntry{
+		Path:   filepath.ToSlash(file.relativePath),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// writeArchive writes the manifest followed by every collected file as a
+// gzipped tar stream.
+func writeArchive(w io.Writer, collection fileCollection, manifest uploadManifest, progress *ux.Progress) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	header := &tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(manifestData)), ModTime: time.Now()}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	if _, err := tarWriter.Write(manifestData); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+
+	for i, file := range collection.files {
+		if err := addArchiveFile(tarWriter, file, manifest.Files[i], progress); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return gzipWriter.Close()
+}
+
+func addArchiveFile(tarWriter *tar.Writer, file collectedFile, entry manifestEntry, progress *ux.Progress) error {
+	fileToUpload, err := file.open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.path, err)
+	}
+	defer fileToUpload.Close()
+
+	header := &tar.Header{Name: entry.Path, Mode: 0644, Size: entry.Size, ModTime: time.Now()}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	// Copy exactly the hashed size so a file that changed since it was hashed
+	// fails the server's checksum instead of corrupting the archive.
+	if _, err := io.CopyN(tarWriter, progress.Reader(fileToUpload), entry.Size); err != nil {
+		return fmt.Errorf("failed to copy file content of %s: %v", file.path, err)
+	}
+	return nil
+}
+
+// verifyManifest compares the manifest the server acknowledged with the one
+// that was sent.
+func verifyManifest(sent uploadManifest, received uploadManifest) error {
+	receivedFiles := map[string]manifestEntry{}
+	for _, entry := range received.Files {
+		receivedFiles[entry.Path] = entry
+	}
+	for _, entry := range sent.Files {
+		receivedEntry, exists := receivedFiles[entry.Path]
+		if !exists {
+			return fmt.Errorf("server did not receive %s", entry.Path)
+		}
+		if receivedEntry.Size != entry.Size || receivedEntry.SHA256 != entry.SHA256 {
+			return fmt.Errorf("server received a different copy of %s", entry.Path)
+		}
+	}
+	if len(received.Files) != len(sent.Files) {
+		return fmt.Errorf("server received %d files but %d were sent", len(received.Files), len(sent.Files))
+	}
+	return nil
+}
+
+const archiveFallbackNotice = "Archive upload not supported by the server, using the legacy upload"
+
+// archiveSupported asks the server whether it takes archive uploads, so auto
+// mode does not send the files twice to servers that predate them. A server
+// that cannot be asked is assumed to take them and the upload reports the
+// error.
+func archiveSupported() bool {
+	req, err := http.NewRequest(http.MethodOptions, url+"/api/cli/submitArchive/", nil)
+	if err != nil {
+		return true
+	}
+	req.Header.Set("Authorization", token)
+	resp, err := doAuthorized(httpClient(), req)
+	if err != nil {
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusNotImplemented
+}
+
+// sendArchive uploads the collected files as a single tar.gz part. supported
+// is false when the server predates archive uploads.
+func sendArchive(collection fileCollection) (success bool, path []byte, supported bool) {
+	supported = true
+
+	manifest, err := buildManifest(collection)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	progress := ux.NewProgress("Uploading files", collection.size())
+
+	// Create a new HTTP request streaming the archive.
+	submitReq, err := newStreamingRequest(url+"/api/cli/submitArchive/", func(writer *multipart.Writer) error {
+		progress.Reset()
+		part, err := writer.CreateFormFile("archive", "maze-upload.tar.gz")
+		if err != nil {
+			return fmt.Errorf("failed to create form file: %v", err)
+		}
+		return writeArchive(part, collection, manifest, progress)
+	})
+	if err != nil {
+		return
+	}
+	submitReq.Header.Set("Authorization", token)
+
+	// Execute the request.
+	resp, err := doAuthorized(httpClient(), submitReq)
+	if err != nil {
+		progress.Fail("Upload failed")
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		progress.Fail("Upload failed")
+		fmt.Println(err)
+		return
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		if uploadMode == "auto" {
+			progress.Notice(archiveFallbackNotice)
+		} else {
+			progress.Fail("Archive upload not supported by the server, use --upload-mode legacy")
+		}
+		return false, nil, false
+	default:
+		progress.Fail("Upload failed")
+		fmt.Println(responseError(resp, bodyBytes))
+		return
+	}
+
+	var acknowledged archiveResponse
+	if err := json.Unmarshal(bodyBytes, &acknowledged); err != nil || acknowledged.Path == "" {
+		progress.Fail("Upload failed, the server response could not be read")
+		return
+	}
+	if err := verifyManifest(manifest, acknowledged.Manifest); err != nil {
+		progress.Fail("Upload failed verification")
+		fmt.Println(err)
+		return
+	}
+
+	progress.Success(fmt.Sprintf("%d files uploaded and verified", len(manifest.Files)))
+	return true, []byte(acknowledged.Path), true
+}
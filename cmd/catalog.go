@@ -0,0 +1,263 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var catalogPath string
+
+// A local price list for estimating cost without the server.
+type priceCatalog struct {
+	Currency string       `json:"currency"`
+	Prices   []priceEntry `json:"prices"`
+}
+
+// The hourly price of a resource type, optionally narrowed down to a region
+// and to attribute values such as instance_type or sku.
+type priceEntry struct {
+	Resource    string            `json:"resource"`
+	Region      string            `json:"region,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	HourlyCost  float64           `json:"hourlyCost"`
+	Description string            `json:"description,omitempty"`
+	// Attribute the price is multiplied by, such as size for a price per GB.
+	Per string `json:"per,omitempty"`
+}
+
+// catalogCmd represents the catalog command
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: ux.ShortTextCatalog,
+	Long:  ux.LongTextCatalog,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// catalogImportCmd represents the catalog import command
+var catalogImportCmd = &cobra.Command{
+	Use:   "import <prices.csv>...",
+	Short: ux.ShortTextCatalogImport,
+	Long:  ux.LongTextCatalogImport,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := importCatalog(args); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// loadCatalog reads a price catalog.
+func loadCatalog(path string) (catalog priceCatalog, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return catalog, fmt.Errorf("could not read catalog %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return catalog, fmt.Errorf("could not parse catalog %s: %w", path, err)
+	}
+	if catalog.Currency == "" {
+		catalog.Currency = "USD"
+	}
+	return catalog, nil
+}
+
+// importCatalog adds the prices in CSV price sheets to the catalog, creating
+// it when needed. Prices for the same resource, region and attributes are
+// replaced.
+func importCatalog(paths []string) error {
+	catalog, err := loadCatalog(catalogPath)
+	if errors.Is(err, os.ErrNotExist) {
+		catalog = priceCatalog{Currency: "USD"}
+	} else if err != nil {
+		return err
+	}
+
+	var importSpinner = ux.NewSpinner("Importing price sheets", "Price sheets imported", "Importing price sheets failed", false)
+	importSpinner.Start()
+	imported := 0
+	for _, path := range paths {
+		entries, err := readPriceSheet(path)
+		if err != nil {
+			importSpinner.Fail()
+			return err
+		}
+		for _, entry := range entries {
+			catalog.Prices = replacePrice(catalog.Prices, entry)
+		}
+		imported += len(entries)
+	}
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		importSpinner.Fail()
+		return err
+	}
+	if err := os.WriteFile(catalogPath, data, 0644); err != nil {
+		importSpinner.Fail()
+		return fmt.Errorf("could not write catalog %s: %w", catalogPath, err)
+	}
+	importSpinner.Success(fmt.Sprintf("Imported %d prices into %s (%d in total)", imported, catalogPath, len(catalog.Prices)))
+	return nil
+}
+
+// readPriceSheet reads a CSV price sheet. The resource column and one of
+// hourly_cost or monthly_cost are required; region, description and per are
+// optional, and every other column is an attribute the resource has to
+// match. Empty attribute cells match anything.
+func readPriceSheet(path string) (entries []priceEntry, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read price sheet %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header of %s: %w", path, err)
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, exists := columns["resource"]; !exists {
+		return nil, fmt.Errorf("%s has no resource column", path)
+	}
+	_, hasHourly := columns["hourly_cost"]
+	_, hasMonthly := columns["monthly_cost"]
+	if !hasHourly && !hasMonthly {
+		return nil, fmt.Errorf("%s needs an hourly_cost or monthly_cost column", path)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+		cell := func(column string) string {
+			if i, exists := columns[column]; exists && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := priceEntry{
+			Resource:    cell("resource"),
+			Region:      cell("region"),
+			Description: cell("description"),
+			Per:         cell("per"),
+		}
+		if entry.Resource == "" {
+			return nil, fmt.Errorf("%s:%d has no resource", path, line)
+		}
+		if price := cell("hourly_cost"); price != "" {
+			if entry.HourlyCost, err = strconv.ParseFloat(price, 64); err != nil {
+				return nil, fmt.Errorf("%s:%d has an invalid hourly_cost %q", path, line, price)
+			}
+		} else {
+			monthly, err := strconv.ParseFloat(cell("monthly_cost"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d has an invalid monthly_cost %q", path, line, cell("monthly_cost"))
+			}
+			entry.HourlyCost = monthly / 730
+		}
+		for column, i := range columns {
+			switch column {
+			case "resource", "region", "description", "per", "hourly_cost", "monthly_cost", "currency":
+				continue
+			}
+			if i < len(record) && strings.TrimSpace(record[i]) != "" {
+				if entry.Attributes == nil {
+					entry.Attributes = map[string]string{}
+				}
+				entry.Attributes[column] = strings.TrimSpace(record[i])
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// replacePrice adds entry to prices, replacing a price for the same resource,
+// region and attributes.
+func replacePrice(prices []priceEntry, entry priceEntry) []priceEntry {
+	for i, price := range prices {
+		if price.Resource == entry.Resource && price.Region == entry.Region && sameAttributes(price.Attributes, entry.Attributes) {
+			prices[i] = entry
+			return prices
+		}
+	}
+	return append(prices, entry)
+}
+
+func sameAttributes(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if b[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findPrice returns the most specific price matching a resource: the one
+// constrained by the most attributes, preferring a region match.
+func (c priceCatalog) findPrice(resourceType string, region string, attributes map[string]string) (price priceEntry, found bool) {
+	best := -1
+	for _, entry := range c.Prices {
+		if entry.Resource != resourceType || (entry.Region != "" && entry.Region != region) {
+			continue
+		}
+		matches := true
+		for key, value := range entry.Attributes {
+			if attributes[key] != value {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		score := 2 * len(entry.Attributes)
+		if entry.Region != "" {
+			score++
+		}
+		if score > best {
+			best, price, found = score, entry, true
+		}
+	}
+	return price, found
+}
+
+func init() {
+
+	catalogImportCmd.Flags().StringVarP(&catalogPath, "catalog", "", "maze-catalog.json", "The catalog file to add the prices to")
+
+	catalogCmd.AddCommand(catalogImportCmd)
+	catalogCmd.SetOutput(color.Output)
+	catalogImportCmd.SetOutput(color.Output)
+
+}
@@ -0,0 +1,259 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	requestTimeout time.Duration
+	requestRetries int
+
+	sharedClient     *http.Client
+	sharedClientOnce sync.Once
+)
+
+const (
+	// The first retry waits about this long, and every retry doubles it.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// A Retry-After longer than this is not waited for.
+	maxRetryAfter = 2 * time.Minute
+)
+
+// addClientFlags registers the flags of the shared HTTP client on a command
+// that talks to the server.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVarP(&requestTimeout, "timeout", "", 2*time.Minute, "How long to wait for the server to answer or send more of an answer (0 waits forever)")
+	cmd.Flags().IntVarP(&requestRetries, "retries", "", 3, "How many times to retry requests that failed on the way or with a transient error")
+}
+
+// httpClient returns the client every request to the server goes through.
+// It waits --timeout for the server to answer, and for every part of the
+// answer, and retries failed requests --retries times.
+func httpClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// Uploads can take longer than the timeout to send, so it bounds
+		// the wait for the answer rather than the whole exchange.
+		transport.ResponseHeaderTimeout = requestTimeout
+		sharedClient = &http.Client{Transport: retryTransport{base: transport}}
+	})
+	return sharedClient
+}
+
+// idleTimeoutBody fails the read of a response body once the server sends
+// nothing for --timeout, by cancelling the request.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, cancel: cancel}
+	b.timer = time.AfterFunc(requestTimeout, func() {
+		b.expired.Store(true)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.expired.Load() {
+		return n, fmt.Errorf("the server stopped sending its answer for %s (change with --timeout)", requestTimeout)
+	}
+	b.timer.Reset(requestTimeout)
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryTransport retries requests that failed on the way or were answered
+// with a transient error. Only idempotent requests are sent again after a
+// network error, a bad gateway or a 429 or 503 without Retry-After, as the
+// server may have acted on the first one. A Retry-After says it did not, so
+// those answers are retried for every request whose body can be produced
+// again. Retries back off exponentially with jitter, or wait as long as
+// Retry-After asks.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithCancel(req.Context())
+		attemptReq = req.WithContext(ctx)
+		if attempt > 0 {
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					cancel()
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		delay, retry := retryDelay(req, resp, err, attempt)
+		if !retry || !replayable || attempt >= requestRetries || req.Context().Err() != nil {
+			if err != nil {
+				cancel()
+				return nil, describeRequestError(err, attempt+1)
+			}
+			if requestTimeout > 0 {
+				resp.Body = newIdleTimeoutBody(resp.Body, cancel)
+			} else {
+				resp.Body = cancelOnClose{resp.Body, cancel}
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		cancel()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// cancelOnClose releases the context of a request once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryDelay decides whether an attempt is retried and how long to wait first.
+func retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	idempotent := isIdempotent(req.Method)
+	if err != nil {
+		return backoff(attempt), idempotent
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if header := resp.Header.Get("Retry-After"); header != "" {
+			delay, valid := parseRetryAfter(header)
+			if !valid || delay > maxRetryAfter {
+				return 0, false
+			}
+			return delay, true
+		}
+		return backoff(attempt), idempotent
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return backoff(attempt), idempotent
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns the exponential delay before a retry, with the upper half
+// picked at random so that clients failing together do not retry together.
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 10 {
+		delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// describeRequestError explains a request that never got an answer.
+func describeRequestError(err error, attempts int) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		err = fmt.Errorf("the server did not answer within %s (change with --timeout): %w", requestTimeout, err)
+	}
+	if attempts > 1 {
+		err = fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+	}
+	return err
+}
+
+// responseError describes a failed response by its status and the message
+// the server sent with it.
+func responseError(resp *http.Response, body []byte) error {
+	return errors.New(strings.TrimSpace(resp.Status + " " + serverMessage(body)))
+}
+
+// doAuthorized executes a request that carries the auth token. When the server
+// answers 401 and the profile holds a refresh token, the tokens are refreshed
+// and the request is sent once more.
+func doAuthorized(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	if refreshAuthToken() != nil {
+		return resp, nil
+	}
+
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retryReq.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	retryReq.Header.Set("Authorization", token)
+	resp.Body.Close()
+	return client.Do(retryReq)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		retryAfter string
+		err        error
+		wantRetry  bool
+		wantDelay  time.Duration
+	}{
+		{"get after network error", http.MethodGet, 0, "", errors.New("reset"), true, -1},
+		{"post after network error", http.MethodPost, 0, "", errors.New("reset"), false, -1},
+		{"get on 502", http.MethodGet, http.StatusBadGateway, "", nil, true, -1},
+		{"post on 502", http.MethodPost, http.StatusBadGateway, "", nil, false, -1},
+		{"get on 429", http.MethodGet, http.StatusTooManyRequests, "", nil, true, -1},
+		{"post on 429", http.MethodPost, http.StatusTooManyRequests, "", nil, false, -1},
+		{"post on 503", http.MethodPost, http.StatusServiceUnavailable, "", nil, false, -1},
+		{"post on 429 with retry-after", http.MethodPost, http.StatusTooManyRequests, "3", nil, true, 3 * time.Second},
+		{"post on 503 with retry-after", http.MethodPost, http.StatusServiceUnavailable, "0", nil, true, 0},
+		{"retry-after too long", http.MethodGet, http.StatusTooManyRequests, "3600", nil, false, -1},
+		{"invalid retry-after", http.MethodGet, http.StatusTooManyRequests, "soon", nil, false, -1},
+		{"not found", http.MethodGet, http.StatusNotFound, "", nil, false, -1},
+		{"ok", http.MethodPost, http.StatusOK, "", nil, false, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "http://maze.test", nil)
+			var resp *http.Response
+			if test.err == nil {
+				resp = &http.Response{StatusCode: test.status, Header: http.Header{}}
+				if test.retryAfter != "" {
+					resp.Header.Set("Retry-After", test.retryAfter)
+				}
+			}
+			delay, retry := retryDelay(req, resp, test.err, 0)
+			if retry != test.wantRetry {
+				t.Errorf("retry = %v, want %v", retry, test.wantRetry)
+			}
+			if test.wantDelay >= 0 && delay != test.wantDelay {
+				t.Errorf("delay = %s, want %s", delay, test.wantDelay)
+			}
+		})
+	}
+}
+
+func TestIdleTimeoutBody(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := requestTimeout
+	requestTimeout = 100 * time.Millisecond
+	defer func() { requestTimeout = timeout }()
+
+	client := &http.Client{Transport: retryTransport{base: http.DefaultTransport}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "stopped sending") {
+			t.Errorf("error = %v, want the server to have stopped sending", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading a stalled body did not time out")
+	}
+}
@@ -0,0 +1,358 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A file selected for upload.
+type collectedFile struct {
+	// Path of the file on disk.
+	path string
+	// Path the server sees, relative to the upload root.
+	relativePath string
+	// Size of the file in bytes.
+	size int64
+	// Content to upload instead of the file on disk, set when values were
+	// redacted.
+	content []byte
+}
+
+// open returns the content to upload.
+func (f collectedFile) open() (io.ReadCloser, error) {
+	if f.content != nil {
+		return io.NopCloser(bytes.NewReader(f.content)), nil
+	}
+	return os.Open(f.path)
+}
+
+// The files selected for upload and where they came from.
+type fileCollection struct {
+	files []collectedFile
+	// Path of --dir relative to the upload root.
+	rootPath string
+	// Local module directories outside of --dir.
+	moduleDirs []string
+	// Modules installed by terraform init that were reused.
+	initModules []initModule
+	// Upload path of the resolved plan, when one was given.
+	planPath string
+	// terraform, opentofu or terragrunt.
+	iac string
+	// Terragrunt units, when iac is terragrunt.
+	units []terragruntUnit
+	// Upload paths of the files given with --var-file, in order.
+	varFiles []string
+	// Whether --var, --var-file or TF_VAR_ values were written to the
+	// generated overrides file.
+	overrides bool
+	// The TF_VAR_ environment variables written to the overrides file.
+	environmentVariables []string
+}
+
+// A module recorded in .terraform/modules/modules.json.
+type initModule struct {
+	Key     string `json:"Key"`
+	Source  string `json:"Source"`
+	Version string `json:"Version"`
+	Dir     string `json:"Dir"`
+}
+
+// read returns the whole content to upload.
+func (f collectedFile) read() ([]byte, error) {
+	if f.content != nil {
+		return f.content, nil
+	}
+	return os.ReadFile(f.path)
+}
+
+// isTerraformFile reports whether a file name has one of the extensions the
+// cli uploads. OpenTofu files and terragrunt configuration are uploaded too.
+func isTerraformFile(fileName string) bool {
+	ext := filepath.Ext(fileName)
+	return strings.HasPrefix(ext, ".tf") || ext == ".tofu" || ext == ".tofuvars" || fileName == terragruntConfigName
+}
+
+// isConfigFile reports whether a path holds terraform or OpenTofu code.
+func isConfigFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".tf" || ext == ".tofu"
+}
+
+// isTerragruntFile reports whether a path holds terragrunt configuration. The
+// only .hcl files collected are terragrunt.hcl and the files they include.
+func isTerragruntFile(path string) bool {
+	return filepath.Ext(path) == ".hcl"
+}
+
+func isStateFile(path string) bool {
+	return filepath.Ext(path) == ".tfstate"
+}
+
+func isVariablesFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".tfvars" || ext == ".tofuvars"
+}
+
+// collectFiles gathers the files to upload from --dir, from the remote
+// modules terraform init already installed and from any local modules it
+// references outside of --dir.
+func collectFiles() (collection fileCollection, err error) {
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		return collection, err
+	}
+
+	collection, err = collectSources(root)
+	if err != nil {
+		return collection, err
+	}
+	files, chosenVarFiles, environmentUsed, err := selectVariables(root, collection.files)
+	if err != nil {
+		return collection, err
+	}
+	collection.environmentVariables = environmentUsed
+
+	// Upload everything relative to the closest directory holding the root and
+	// all of its modules so the module sources still resolve on the server.
+	// Terragrunt units may also include configuration from parent folders.
+	uploadRoot := root
+	for _, file := range files {
+		uploadRoot = commonDir(uploadRoot, filepath.Dir(file.path))
+	}
+	for i := range files {
+		if files[i].relativePath, err = filepath.Rel(uploadRoot, files[i].path); err != nil {
+			return collection, fmt.Errorf("failed to compute relative path: %v", err)
+		}
+	}
+	if collection.rootPath, err = filepath.Rel(uploadRoot, root); err != nil {
+		return collection, fmt.Errorf("failed to compute relative path: %v", err)
+	}
+	for _, varFile := range chosenVarFiles {
+		if strings.HasSuffix(varFile, ".json") {
+			continue
+		}
+		relativePath, err := filepath.Rel(uploadRoot, varFile)
+		if err != nil {
+			return collection, fmt.Errorf("failed to compute relative path: %v", err)
+		}
+		collection.varFiles = append(collection.varFiles, relativePath)
+	}
+	for _, file := range files {
+		if file.path == filepath.Join(root, overridesName) {
+			collection.overrides = true
+		}
+	}
+
+	// Send the resolved plan next to the root module's files, or on its own.
+	if planJSONPath != "" || planFilePath != "" {
+		planFile, err := loadPlan(collection.iac)
+		if err != nil {
+			return collection, err
+		}
+		if planOnly {
+			files = nil
+		}
+		planFile.relativePath = filepath.Join(collection.rootPath, planUploadName)
+		collection.planPath = planFile.relativePath
+		files = append(files, planFile)
+	}
+	collection.files = files
+	return collection, nil
+}
+
+// collectSources gathers the terraform files below root together with the
+// modules and terragrunt units they use, before variables are selected.
+func collectSources(root string) (collection fileCollection, err error) {
+	files, err := walkRoot(root)
+	if err != nil {
+		return collection, err
+	}
+
+	if useInitModules {
+		moduleFiles, modules, err := readInitModules(root)
+		if err != nil {
+			return collection, fmt.Errorf("failed to read modules installed by terraform init: %v", err)
+		}
+		files = append(files, moduleFiles...)
+		collection.initModules = modules
+	}
+
+	collection.iac = detectIaC(files)
+	if collection.iac == "terragrunt" {
+		unitFiles, units, moduleDirs, err := readTerragrunt(root, files)
+		if err != nil {
+			return collection, fmt.Errorf("failed to read terragrunt configuration: %v", err)
+		}
+		files = append(files, unitFiles...)
+		collection.units = units
+		collection.moduleDirs = moduleDirs
+	}
+
+	// Follow the local module sources of every collected file. The list grows
+	// as modules are added so their own modules are followed too, and visited
+	// stops cycles between modules.
+	visited := map[string]bool{}
+	for _, moduleDir := range collection.moduleDirs {
+		visited[moduleDir] = true
+	}
+	for i := 0; i < len(files); i++ {
+		if !isConfigFile(files[i].path) {
+			continue
+		}
+		body, err := parseHCLFile(files[i].path)
+		if err != nil {
+			// The server reports syntax errors, so keep going with the files
+			// that do parse.
+			continue
+		}
+		for _, source := range localModuleSources(body) {
+			moduleDir := filepath.Join(filepath.Dir(files[i].path), filepath.FromSlash(source))
+			if isWithin(root, moduleDir) || visited[moduleDir] {
+				continue
+			}
+			visited[moduleDir] = true
+
+			moduleFiles, err := readModuleDir(moduleDir)
+			if err != nil {
+				return collection, fmt.Errorf("failed to read module %s referenced from %s: %v", source, files[i].path, err)
+			}
+			files = append(files, moduleFiles...)
+			collection.moduleDirs = append(collection.moduleDirs, moduleDir)
+		}
+	}
+
+	collection.files = files
+	return collection, nil
+}
+
+// readInitModules collects the remote modules terraform init downloaded into
+// .terraform/modules, together with the modules.json that maps module keys to
+// their directories. Local modules are left to the module source walk.
+func readInitModules(root string) (files []collectedFile, modules []initModule, err error) {
+	manifestPath := filepath.Join(root, ".terraform", "modules", "modules.json")
+	data, err := os.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest struct {
+		Modules []initModule `json:"Modules"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("could not parse %s: %v", manifestPath, err)
+	}
+
+	installDir := filepath.Join(root, ".terraform", "modules")
+	seen := map[string]bool{}
+	for _, module := range manifest.Modules {
+		moduleDir := filepath.Join(root, filepath.FromSlash(module.Dir))
+		if module.Key == "" || !isWithin(installDir, moduleDir) || seen[moduleDir] {
+			continue
+		}
+		seen[moduleDir] = true
+		moduleFiles, err := readModuleDir(moduleDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read module %s: %v", module.Key, err)
+		}
+		files = append(files, moduleFiles...)
+		modules = append(modules, module)
+	}
+	if len(modules) > 0 {
+		files = append(files, collectedFile{path: manifestPath, size: int64(len(data))})
+	}
+	return files, modules, nil
+}
+
+// walkRoot collects the terraform files below root, honouring the ignore
+// files and the output directory.
+func walkRoot(root string) (files []collectedFile, err error) {
+	folderPath, err := filepath.Abs(outputPath())
+	if err != nil {
+		return nil, err
+	}
+	matcher := newIgnoreMatcher(includeGlobs, excludeGlobs)
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Compute the relative path of the file to the base directory.
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path: %v", err)
+		}
+
+		if info.IsDir() {
+			// Skip the output directory and terraform's own working directory.
+			if info.Name() == "maze-output" || info.Name() == ".terraform" || path == folderPath {
+				return filepath.SkipDir
+			}
+			if relativePath != "." && matcher.ignored(relativePath, true) {
+				return filepath.SkipDir
+			}
+
+			// Read the ignore files before walking into the directory.
+			if relativePath == "." {
+				relativePath = ""
+			}
+			return matcher.loadDir(path, filepath.ToSlash(relativePath), useGitignore)
+		}
+
+		if isTerraformFile(info.Name()) && !matcher.ignored(relativePath, false) {
+			files = append(files, collectedFile{path: path, size: info.Size()})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readModuleDir collects the terraform files of a module. Like terraform, only
+// the files directly in the module directory belong to it.
+func readModuleDir(moduleDir string) (files []collectedFile, err error) {
+	entries, err := os.ReadDir(moduleDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isTerraformFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, collectedFile{path: filepath.Join(moduleDir, entry.Name()), size: info.Size()})
+	}
+	return files, nil
+}
+
+// isWithin reports whether path is dir or one of its descendants.
+func isWithin(dir string, path string) bool {
+	relativePath, err := filepath.Rel(dir, path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// commonDir returns the deepest directory containing both a and b.
+func commonDir(a string, b string) string {
+	for !isWithin(a, b) {
+		parent := filepath.Dir(a)
+		if parent == a {
+			break
+		}
+		a = parent
+	}
+	return a
+}
@@ -0,0 +1,338 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/cobra"
+)
+
+var (
+	localCompliance bool
+	skipChecks      []string
+)
+
+// Matches suppression comments such as
+// # maze:skip=MAZE_AWS_7:Logs are shipped elsewhere
+var skipCommentPattern = regexp.MustCompile(`(?:#|//)\s*maze:skip=([A-Za-z0-9_]+)(?::\s*(.*))?`)
+
+// complyCmd represents the comply command
+var complyCmd = &cobra.Command{
+	Use:   "comply",
+	Short: ux.ShortTextComply,
+	Long:  ux.LongTextComply,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := mazeComply(); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+func mazeComply() error {
+	var data Response
+	var collection fileCollection
+	if localCompliance {
+		var err error
+		if collection, err = collectFiles(); err != nil {
+			fmt.Println(err)
+			return err
+		}
+		var success bool
+		if success, data = localComplianceStep(collection); !success {
+			return errors.New("compliance testing failed")
+		}
+	} else {
+		if !authStep() {
+			return errors.New("authentication failed")
+		}
+		var success bool
+		if collection, success = readFileStep(); !success {
+			return errors.New("reading files failed")
+		}
+		success, path := uploadStep(collection)
+		if !success {
+			return errors.New("upload failed")
+		}
+		if err := os.MkdirAll(outputPath(), os.ModePerm); err != nil {
+			fmt.Println(err)
+		}
+		data = complianceStep(string(path))
+		deleteFilesStep(string(path))
+	}
+	if policyDir != "" {
+		var success bool
+		if success, data = policyStep(data, collection); !success {
+			return errors.New("policy evaluation failed")
+		}
+	}
+	command := "comply"
+	if localCompliance {
+		command = "comply --local"
+	}
+	run := newHistoryEntry(command)
+	run.addCompliance(data)
+	recordRun(run)
+	return checkThresholds(data, Cost{}, false)
+}
+
+// A resource found locally, with where it was declared.
+type localResource struct {
+	ruleResource
+	file  collectedFile
+	block *hclsyntax.Block
+	// Directory of the module relative to --dir, empty for the root module.
+	moduleDir string
+}
+
+// readLocalResources parses the resources of every collected module and
+// prepares them for evaluation. Resources whose count or for_each is known
+// to be empty are left out. It also returns how many files did not parse.
+func readLocalResources(collection fileCollection, root string) (resources []localResource, parsingErrors int) {
+	type parsedFile struct {
+		file collectedFile
+		body *hclsyntax.Body
+	}
+	filesByDir := map[string][]parsedFile{}
+	var dirs []string
+	for _, file := range collection.files {
+		if !isConfigFile(file.path) {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			parsingErrors++
+			continue
+		}
+		dir := filepath.Dir(file.path)
+		if _, exists := filesByDir[dir]; !exists {
+			dirs = append(dirs, dir)
+		}
+		filesByDir[dir] = append(filesByDir[dir], parsedFile{file, body})
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		var bodies []*hclsyntax.Body
+		for _, parsed := range filesByDir[dir] {
+			bodies = append(bodies, parsed.body)
+		}
+		ctx, _ := moduleEvalContext(collection, dir, dir == root, bodies, nil)
+		moduleDir := ""
+		if dir != root {
+			if relativeDir, err := filepath.Rel(root, dir); err == nil {
+				moduleDir = filepath.ToSlash(relativeDir)
+			}
+		}
+
+		first := len(resources)
+		var module []ruleResource
+		for _, parsed := range filesByDir[dir] {
+			for _, block := range parsed.body.Blocks {
+				if block.Type != "resource" || len(block.Labels) != 2 || resourceInstances(block.Body, ctx) == 0 {
+					continue
+				}
+				resource := localResource{
+					ruleResource: ruleResource{typeName: block.Labels[0], name: block.Labels[1], body: block.Body, ctx: ctx},
+					file:         parsed.file,
+					block:        block,
+					moduleDir:    moduleDir,
+				}
+				resources = append(resources, resource)
+				module = append(module, resource.ruleResource)
+			}
+		}
+		for i := first; i < len(resources); i++ {
+			resources[i].module = module
+		}
+	}
+	return resources, parsingErrors
+}
+
+// localComplianceStep runs the built in rules against the collected terraform
+// and saves the results in the same format as the server.
+func localComplianceStep(collection fileCollection) (success bool, data Response) {
+	var complianceStartSpinner = ux.NewSpinner("Starting local compliance testing", "Compliance testing complete", "Compliance testing failed", false)
+	complianceStartSpinner.Start()
+
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		complianceStartSpinner.Fail()
+		fmt.Println(err)
+		return false, data
+	}
+	data = runComplianceRules(collection, root)
+	complianceStartSpinner.Success()
+
+	known := map[string]bool{}
+	for _, rule := range complianceRules {
+		known[rule.id] = true
+	}
+	for _, id := range skipChecks {
+		if !known[id] {
+			fmt.Println("Unknown check in --skip-check:", id)
+		}
+	}
+
+	fmt.Printf("Summary:\n")
+	fmt.Printf("    Passed: %d\n", data.Summary.Passed)
+	fmt.Printf("    Failed: %d\n", data.Summary.Failed)
+	fmt.Printf("    Skipped: %d\n", data.Summary.Skipped)
+	printChecks(data.Results.FailedChecks)
+
+	return saveComplianceResults(data), data
+}
+
+// printChecks prints a table of checks with where the resources are declared.
+func printChecks(checks []Check) {
+	if len(checks) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("CHECK")+"\t"+ux.BlueColor("RESOURCE")+"\t"+ux.BlueColor("LOCATION")+"\t"+ux.BlueColor("DESCRIPTION"))
+	for _, check := range checks {
+		location := strings.TrimPrefix(check.FilePath, "/")
+		if len(check.FileLineRange) > 0 {
+			location = fmt.Sprintf("%s:%d", location, check.FileLineRange[0])
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.CheckID, check.Resource, location, check.CheckName)
+	}
+	w.Flush()
+}
+
+// saveComplianceResults writes the compliance results to the output folder.
+func saveComplianceResults(data Response) bool {
+	bodyBytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if err := os.MkdirAll(outputPath(), os.ModePerm); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	filePath := outputPath("maze_compliance_results.json")
+	if err := os.WriteFile(filePath, bodyBytes, 0644); err != nil {
+		fmt.Printf("Failed to write response to file: %v\n", err)
+		return false
+	}
+	fmt.Printf("Full compliance test saved to %s\n", filePath)
+	return true
+}
+
+// runComplianceRules checks every resource of the collected modules against
+// the rules for its type. Checks listed in --skip-check, or in a maze:skip
+// comment inside the resource block, are reported as skipped.
+func runComplianceRules(collection fileCollection, root string) (data Response) {
+	data.CheckType = "terraform"
+	data.Results.FailedChecks = []Check{}
+
+	skipped := map[string]bool{}
+	for _, id := range skipChecks {
+		skipped[strings.TrimSpace(id)] = true
+	}
+
+	resources, parsingErrors := readLocalResources(collection, root)
+	data.Summary.ParsingErrors = parsingErrors
+	data.Summary.ResourceCount = len(resources)
+	for _, resource := range resources {
+		suppressed := skipComments(resource)
+		for _, rule := range rulesFor(resource.typeName) {
+			check := resource.check(rule.id, rule.name)
+			if reason, exists := suppressed[rule.id]; exists || skipped[rule.id] {
+				check.CheckResult.Result = "SKIPPED"
+				check.SuppressComment = reason
+				data.Results.SkippedChecks = append(data.Results.SkippedChecks, check)
+				data.Summary.Skipped++
+				continue
+			}
+			passed, evaluatedKeys := rule.check(resource.ruleResource)
+			check.CheckResult.EvaluatedKeys = evaluatedKeys
+			if passed {
+				check.CheckResult.Result = "PASSED"
+				data.Results.PassedChecks = append(data.Results.PassedChecks, check)
+				data.Summary.Passed++
+			} else {
+				check.CheckResult.Result = "FAILED"
+				data.Results.FailedChecks = append(data.Results.FailedChecks, check)
+				data.Summary.Failed++
+			}
+		}
+	}
+	return data
+}
+
+// check returns a check of the resource with its location filled in.
+func (r localResource) check(id string, name string) Check {
+	return Check{
+		CheckID:       id,
+		CheckName:     name,
+		FilePath:      "/" + r.file.relativePath,
+		FileLineRange: []int{r.block.Range().Start.Line, r.block.Range().End.Line},
+		Resource:      r.typeName + "." + r.name,
+	}
+}
+
+// skipComments returns the checks suppressed by maze:skip comments inside a
+// resource block, with the reason given for each.
+func skipComments(resource localResource) map[string]string {
+	suppressed := map[string]string{}
+	src, err := resource.file.read()
+	if err != nil {
+		return suppressed
+	}
+	blockRange := resource.block.Range()
+	if blockRange.End.Byte > len(src) {
+		return suppressed
+	}
+	for _, match := range skipCommentPattern.FindAllSubmatch(src[blockRange.Start.Byte:blockRange.End.Byte], -1) {
+		suppressed[string(match[1])] = strings.TrimSpace(string(match[2]))
+	}
+	return suppressed
+}
+
+func init() {
+
+	complyCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
+	complyCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to get the auth token from")
+	complyCmd.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+	addClientFlags(complyCmd)
+	complyCmd.Flags().BoolVarP(&localCompliance, "local", "", false, "Run the built in rules locally without contacting the server")
+	complyCmd.Flags().StringSliceVarP(&skipChecks, "skip-check", "", nil, "Report these local checks as skipped, e.g. MAZE_AWS_7")
+	complyCmd.Flags().StringVarP(&policyDir, "policy-dir", "", "", "Also evaluate the Rego policies in this directory")
+	complyCmd.Flags().StringSliceVarP(&includeGlobs, "include", "", nil, "Only read files matching these gitignore style patterns")
+	complyCmd.Flags().StringSliceVarP(&excludeGlobs, "exclude", "", nil, "Never read files matching these gitignore style patterns")
+	complyCmd.Flags().BoolVarP(&useGitignore, "gitignore", "", false, "Also skip files ignored by .gitignore files")
+	complyCmd.Flags().BoolVarP(&useInitModules, "init-modules", "", true, "Read the remote modules terraform init installed in .terraform/modules")
+	complyCmd.Flags().StringVarP(&iacMode, "iac", "", "auto", "The kind of code in --dir: terraform, opentofu, terragrunt, or auto to detect it")
+	complyCmd.Flags().VarP(variableFlag{"var-file"}, "var-file", "", "Use this variables file, relative to --dir")
+	complyCmd.Flags().VarP(variableFlag{"var"}, "var", "", "Set a variable as name=value, like terraform -var")
+	complyCmd.Flags().BoolVarP(&skipEnvVars, "no-env-vars", "", false, "Ignore TF_VAR_ environment variables")
+	complyCmd.Flags().StringVarP(&planJSONPath, "plan-json", "", "", "A plan rendered by terraform show -json, used as the policy input")
+	complyCmd.Flags().StringVarP(&planFilePath, "plan-file", "", "", "A saved plan from terraform plan -out, rendered locally with terraform show -json")
+	complyCmd.Flags().StringVarP(&terraformBin, "terraform-bin", "", "", "The binary used to render --plan-file, tofu for OpenTofu code and terraform otherwise")
+	addUploadFlags(complyCmd)
+	complyCmd.Flags().StringVarP(&outputDir, "output-dir", "", "maze-output", "The folder for results, relative to the terraform directory")
+	complyCmd.Flags().IntVarP(&maxFailedChecks, "max-failed-checks", "", -1, "Fail when more compliance checks fail than this (-1 disables the check)")
+	complyCmd.Flags().BoolVarP(&skipHistory, "no-history", "", false, "Do not record the run in .maze/history.jsonl")
+
+	complyCmd.SetOutput(color.Output)
+
+}
@@ -0,0 +1,374 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the project configuration file, in order of preference.
+var projectConfigNames = []string{".maze.yaml", ".maze.yml"}
+
+// Project configuration read from .maze.yaml in the terraform root or one of
+// its parents. Every value can be overridden by the matching flag.
+type projectConfig struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Tags        map[string]string `yaml:"tags"`
+	ProjectID   string            `yaml:"project_id"`
+	Provider    string            `yaml:"provider"`
+	Providers   []string          `yaml:"providers"`
+	Profile     string            `yaml:"profile"`
+	URL         string            `yaml:"url"`
+	Include     []string          `yaml:"include"`
+	Exclude     []string          `yaml:"exclude"`
+	Gitignore   *bool             `yaml:"gitignore"`
+	Redact      struct {
+		Keys []string `yaml:"keys"`
+	} `yaml:"redact"`
+	Upload struct {
+		Mode      string `yaml:"mode"`
+		MaxSizeMB *int64 `yaml:"max_size_mb"`
+	} `yaml:"upload"`
+	Output struct {
+		Dir         string `yaml:"dir"`
+		Image       *bool  `yaml:"image"`
+		ImageFormat string `yaml:"image_format"`
+		ImageWidth  *int   `yaml:"image_width"`
+		Theme       string `yaml:"theme"`
+	} `yaml:"output"`
+	Thresholds struct {
+		MaxMonthlyCost  *float64 `yaml:"max_monthly_cost"`
+		MaxFailedChecks *int     `yaml:"max_failed_checks"`
+	} `yaml:"thresholds"`
+	Compliance struct {
+		SkipChecks []string `yaml:"skip_checks"`
+		PolicyDir  string   `yaml:"policy_dir"`
+	} `yaml:"compliance"`
+	HTTP struct {
+		Timeout string `yaml:"timeout"`
+		Retries *int   `yaml:"retries"`
+	} `yaml:"http"`
+}
+
+// A single merged setting and where its value came from.
+type configValue struct {
+	key    string
+	value  string
+	source string
+}
+
+var (
+	includeGlobs      []string
+	excludeGlobs      []string
+	useGitignore      bool
+	useInitModules    bool
+	outputDir         string
+	maxMonthlyCost    float64
+	maxFailedChecks   int
+	projectConfigPath string
+	configValues      []configValue
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: ux.ShortTextConfig,
+	Long:  ux.LongTextConfig,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: ux.ShortTextConfigShow,
+	Long:  ux.LongTextConfigShow,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		showConfig()
+	},
+}
+
+func showConfig() {
+	if projectConfigPath == "" {
+		fmt.Println("No project configuration file found, using flags and defaults")
+	} else {
+		fmt.Println("Project configuration:", projectConfigPath)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("KEY")+"\t"+ux.BlueColor("VALUE")+"\t"+ux.BlueColor("SOURCE"))
+	for _, value := range configValues {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", value.key, value.value, value.source)
+	}
+	w.Flush()
+}
+
+// findProjectConfig looks for a project configuration file in dir and each of
+// its parents, returning an empty path when there is none.
+func findProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, configName := range projectConfigNames {
+			candidate := filepath.Join(dir, configName)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate, nil
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadProjectConfig reads and parses a project configuration file. It also
+// returns the keys no setting reads, such as misspelled ones.
+func loadProjectConfig(path string) (config projectConfig, unknownKeys []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return config, nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	if err := document.Decode(&config); err != nil {
+		return config, nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return config, unknownConfigKeys(&document, reflect.TypeOf(config), ""), nil
+}
+
+// unknownConfigKeys returns the keys below node that have no field in
+// configType, as dotted paths like output.imge.
+func unknownConfigKeys(node *yaml.Node, configType reflect.Type, prefix string) (keys []string) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if configType.Kind() == reflect.Pointer {
+		configType = configType.Elem()
+	}
+	if node.Kind != yaml.MappingNode || configType.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		field, found := configField(configType, key)
+		if !found {
+			keys = append(keys, prefix+key)
+			continue
+		}
+		keys = append(keys, unknownConfigKeys(node.Content[i+1], field.Type, prefix+key+".")...)
+	}
+	return keys
+}
+
+// configField finds the field of a configuration struct read from key.
+func configField(configType reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if tagName, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); tagName == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// applyProjectConfig loads the project configuration for --dir and uses it
+// for every flag that was not given on the command line. The merged values
+// and their sources are recorded in configValues.
+func applyProjectConfig(cmd *cobra.Command) error {
+	var config projectConfig
+	path, err := findProjectConfig(dirPath)
+	if err != nil {
+		return fmt.Errorf("could not look for project configuration: %w", err)
+	}
+	if path != "" {
+		var unknownKeys []string
+		if config, unknownKeys, err = loadProjectConfig(path); err != nil {
+			return err
+		}
+		if len(unknownKeys) > 0 {
+			fmt.Printf("Ignoring unknown keys in %s: %s\n", path, strings.Join(unknownKeys, ", "))
+		}
+	}
+	projectConfigPath = path
+	configValues = nil
+
+	fileSource := "file " + path
+	fromFlag := func(key string, flagName string, fileValue string) error {
+		flag := cmd.Flags().Lookup(flagName)
+		if flag == nil {
+			return nil
+		}
+		source := "default"
+		if flag.Changed {
+			source = "flag --" + flagName
+		} else if fileValue != "" {
+			if err := flag.Value.Set(fileValue); err != nil {
+				return fmt.Errorf("invalid %s in %s: %w", key, path, err)
+			}
+			source = fileSource
+		}
+		configValues = append(configValues, configValue{key, flag.Value.String(), source})
+		return nil
+	}
+	fromSliceFlag := func(key string, flagName string, fileValue []string) error {
+		flag := cmd.Flags().Lookup(flagName)
+		if flag == nil {
+			return nil
+		}
+		sliceValue := flag.Value.(pflag.SliceValue)
+		source := "default"
+		if flag.Changed {
+			source = "flag --" + flagName
+		} else if len(fileValue) > 0 {
+			if err := sliceValue.Replace(fileValue); err != nil {
+				return fmt.Errorf("invalid %s in %s: %w", key, path, err)
+			}
+			source = fileSource
+		}
+		configValues = append(configValues, configValue{key, strings.Join(sliceValue.GetSlice(), ","), source})
+		return nil
+	}
+
+	image := ""
+	if config.Output.Image != nil {
+		image = strconv.FormatBool(*config.Output.Image)
+	}
+	monthlyCost := ""
+	if config.Thresholds.MaxMonthlyCost != nil {
+		monthlyCost = strconv.FormatFloat(*config.Thresholds.MaxMonthlyCost, 'f', -1, 64)
+	}
+	gitignore := ""
+	if config.Gitignore != nil {
+		gitignore = strconv.FormatBool(*config.Gitignore)
+	}
+	maxSize := ""
+	if config.Upload.MaxSizeMB != nil {
+		maxSize = strconv.FormatInt(*config.Upload.MaxSizeMB, 10)
+	}
+	width := ""
+	if config.Output.ImageWidth != nil {
+		width = strconv.Itoa(*config.Output.ImageWidth)
+	}
+	failedChecks := ""
+	if config.Thresholds.MaxFailedChecks != nil {
+		failedChecks = strconv.Itoa(*config.Thresholds.MaxFailedChecks)
+	}
+	retries := ""
+	if config.HTTP.Retries != nil {
+		retries = strconv.Itoa(*config.HTTP.Retries)
+	}
+
+	flagValues := []struct{ key, flag, value string }{
+		{"name", "name", config.Name},
+		{"description", "description", config.Description},
+		{"project_id", "project-id", config.ProjectID},
+		{"profile", "profile", config.Profile},
+		{"url", "url", config.URL},
+		{"upload.mode", "upload-mode", config.Upload.Mode},
+		{"upload.max_size_mb", "max-upload-size", maxSize},
+		{"output.dir", "output-dir", config.Output.Dir},
+		{"output.image", "image", image},
+		{"output.image_format", "image-format", config.Output.ImageFormat},
+		{"output.image_width", "image-width", width},
+		{"output.theme", "theme", config.Output.Theme},
+		{"thresholds.max_monthly_cost", "max-monthly-cost", monthlyCost},
+		{"thresholds.max_failed_checks", "max-failed-checks", failedChecks},
+		{"compliance.policy_dir", "policy-dir", config.Compliance.PolicyDir},
+		{"http.timeout", "timeout", config.HTTP.Timeout},
+		{"http.retries", "retries", retries},
+	}
+	for _, value := range flagValues {
+		if err := fromFlag(value.key, value.flag, value.value); err != nil {
+			return err
+		}
+	}
+	configProviders := config.Providers
+	if config.Provider != "" {
+		configProviders = append([]string{config.Provider}, configProviders...)
+	}
+	if err := fromSliceFlag("providers", "provider", configProviders); err != nil {
+		return err
+	}
+	if err := fromSliceFlag("tags", "tag", tagValues(config.Tags)); err != nil {
+		return err
+	}
+	if err := fromSliceFlag("include", "include", config.Include); err != nil {
+		return err
+	}
+	if err := fromSliceFlag("exclude", "exclude", config.Exclude); err != nil {
+		return err
+	}
+	if err := fromSliceFlag("redact.keys", "redact-keys", config.Redact.Keys); err != nil {
+		return err
+	}
+	if err := fromSliceFlag("compliance.skip_checks", "skip-check", config.Compliance.SkipChecks); err != nil {
+		return err
+	}
+	return fromFlag("gitignore", "gitignore", gitignore)
+}
+
+// outputPath returns the path of a file in the output directory.
+func outputPath(elem ...string) string {
+	folderPath := outputDir
+	if !filepath.IsAbs(folderPath) {
+		folderPath = filepath.Join(dirPath, folderPath)
+	}
+	return filepath.Join(append([]string{folderPath}, elem...)...)
+}
+
+// checkThresholds compares the compliance and cost results against the
+// configured thresholds and returns an error describing any breach.
+func checkThresholds(data Response, cost Cost, costCalculated bool) error {
+	var breaches []string
+	if maxFailedChecks >= 0 && data.Summary.Failed > maxFailedChecks {
+		breaches = append(breaches, fmt.Sprintf("%d failed compliance checks (maximum %d)", data.Summary.Failed, maxFailedChecks))
+	}
+	if maxMonthlyCost > 0 && costCalculated && cost.TotalCost*730 > maxMonthlyCost {
+		breaches = append(breaches, fmt.Sprintf("monthly cost $%v (maximum $%v)", roundFloat(cost.TotalCost*730, 2), maxMonthlyCost))
+	}
+	if len(breaches) == 0 {
+		return nil
+	}
+	for _, breach := range breaches {
+		fmt.Printf("%s Threshold exceeded: %s\n", ux.PrintRed("✘"), breach)
+	}
+	return errors.New("thresholds exceeded")
+}
+
+func init() {
+
+	configCmd.AddCommand(configShowCmd)
+	configCmd.SetOutput(color.Output)
+	configShowCmd.SetOutput(color.Output)
+
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProjectConfigUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"known keys", "name: shop\ntags:\n  team: web\noutput:\n  image: true\nhttp:\n  retries: 3\n", nil},
+		{"misspelled top level key", "nmae: shop\n", []string{"nmae"}},
+		{"misspelled nested key", "output:\n  imge: true\n  theme: dark\n", []string{"output.imge"}},
+		{"nested under a scalar", "thresholds:\n  max_monthly_cost: 5\n  max_cost: 5\n", []string{"thresholds.max_cost"}},
+		{"tags are free form", "tags:\n  anything: goes\n", nil},
+		{"empty file", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := writeFiles(t, map[string]string{".maze.yaml": test.content})
+			_, unknownKeys, err := loadProjectConfig(filepath.Join(root, ".maze.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(unknownKeys, test.want) {
+				t.Errorf("unknown keys = %v, want %v", unknownKeys, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var (
+	offline   bool
+	projectID string
+)
+
+// costCmd represents the cost command
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: ux.ShortTextCost,
+	Long:  ux.LongTextCost,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := mazeCost(); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+func mazeCost() error {
+	var cost Cost
+	if offline {
+		var calculated bool
+		if calculated, cost = offlineCostStep(); !calculated {
+			return errors.New("cost estimation failed")
+		}
+	} else {
+		if projectID == "" {
+			fmt.Println("Use --project-id to get the cost of a maze project, or --offline to estimate it from a local catalog")
+			return errors.New("no project")
+		}
+		if !authStep() {
+			return errors.New("authentication failed")
+		}
+		var calculated bool
+		if calculated, cost = costStep(projectID); !calculated {
+			return errors.New("cost calculation failed")
+		}
+	}
+	command := "cost"
+	if offline {
+		command = "cost --offline"
+	}
+	run := newHistoryEntry(command)
+	run.ProjectID = projectID
+	run.addCost(cost)
+	recordRun(run)
+	return checkThresholds(Response{}, cost, true)
+}
+
+// printCost prints the daily and monthly totals of an hourly cost.
+func printCost(cost Cost) {
+	fmt.Println(fmt.Sprint("    Daily cost: $", roundFloat(cost.TotalCost*24, 2)))
+	fmt.Println(fmt.Sprint("    Monthly cost: $", roundFloat(cost.TotalCost*730, 2)))
+}
+
+// offlineCostStep estimates the cost of the terraform in --dir from the
+// catalog given with --catalog.
+func offlineCostStep() (success bool, cost Cost) {
+	var costStartSpinner = ux.NewSpinner("Estimating cloud cost from "+catalogPath, "Cost estimated", "Cost estimation failed", false)
+	costStartSpinner.Start()
+
+	catalog, err := loadCatalog(catalogPath)
+	if err != nil {
+		costStartSpinner.Fail()
+		fmt.Println(err)
+		return false, cost
+	}
+	collection, err := collectFiles()
+	if err != nil {
+		costStartSpinner.Fail()
+		fmt.Println(err)
+		return false, cost
+	}
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		costStartSpinner.Fail()
+		fmt.Println(err)
+		return false, cost
+	}
+
+	cost, unpriced, missing := estimateCost(collection, root, catalog)
+	costStartSpinner.Success()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("RESOURCE")+"\t"+ux.BlueColor("DESCRIPTION")+"\t"+ux.BlueColor("MONTHLY COST"))
+	for _, resource := range cost.Resources {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", resource.Resource, resource.Description, fmt.Sprint("$", roundFloat(resource.HourlyCost*730, 2)))
+	}
+	w.Flush()
+	printCost(cost)
+	if len(unpriced) > 0 {
+		fmt.Println("Not in the catalog, so not included:")
+		for _, resource := range unpriced {
+			fmt.Println(" -", resource)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Println("Modules that are not on disk, so not included (run terraform init first):")
+		for _, module := range missing {
+			fmt.Println(" -", module)
+		}
+	}
+	return true, cost
+}
+
+// estimateCost prices the managed resources of the root module and of every
+// module it calls, or of the terragrunt units. Each module call is evaluated
+// with the arguments it passes and counted as often as its count or for_each
+// creates it, and modules nothing calls are not priced. It returns the
+// resources that had no matching price and the module calls whose module is
+// not on disk.
+func estimateCost(collection fileCollection, root string, catalog priceCatalog) (cost Cost, unpriced []string, missing []string) {
+	estimate := costEstimate{catalog: catalog, bodiesByDir: map[string][]*hclsyntax.Body{}}
+	estimate.cost.Resources = []Resources{}
+	for _, file := range collection.files {
+		if !isConfigFile(file.path) {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(file.path)
+		estimate.bodiesByDir[dir] = append(estimate.bodiesByDir[dir], body)
+	}
+
+	if len(estimate.bodiesByDir[root]) > 0 {
+		installed := map[string]string{}
+		for _, module := range collection.initModules {
+			installed[module.Key] = filepath.Join(root, filepath.FromSlash(module.Dir))
+		}
+		estimate.addModule(costModule{dir: root, collection: &collection, installed: installed, instances: 1})
+	}
+	for _, unit := range collection.units {
+		address := unit.dir
+		if relativeDir, err := filepath.Rel(root, unit.dir); err == nil {
+			address = filepath.ToSlash(relativeDir)
+		}
+		dir, ok := localSourceDir(unit)
+		if !ok || len(estimate.bodiesByDir[dir]) == 0 {
+			estimate.missing = append(estimate.missing, address)
+			continue
+		}
+		estimate.addModule(costModule{dir: dir, address: address + ":", arguments: unit.inputs, instances: 1})
+	}
+	return estimate.cost, estimate.unpriced, estimate.missing
+}
+
+// costEstimate adds up the cost of the module instances it walks through.
+type costEstimate struct {
+	catalog     priceCatalog
+	bodiesByDir map[string][]*hclsyntax.Body
+	cost        Cost
+	unpriced    []string
+	missing     []string
+}
+
+// A module instance being priced.
+type costModule struct {
+	dir string
+	// Prefix of the addresses of its resources, like module.vpc.
+	address string
+	// Set for the root module, whose tfvars files are read too.
+	collection *fileCollection
+	// Directories of the modules terraform init installed, by module key.
+	installed map[string]string
+	// Key of the module call in modules.json, like vpc.subnets.
+	key       string
+	arguments map[string]cty.Value
+	// How many instances the calls leading here create together.
+	instances int
+	// Regions of the providers passed down by the calling module.
+	regions map[string]string
+	// Directories of the calling modules, to stop cycles.
+	callers []string
+}
+
+func (e *costEstimate) addModule(module costModule) {
+	bodies := e.bodiesByDir[module.dir]
+	collection := fileCollection{}
+	if module.collection != nil {
+		collection = *module.collection
+	}
+	ctx, regions := moduleEvalContext(collection, module.dir, module.collection != nil, bodies, module.arguments)
+	for providerName, region := range module.regions {
+		if _, exists := regions[providerName]; !exists {
+			regions[providerName] = region
+		}
+	}
+
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			switch {
+			case block.Type == "resource" && len(block.Labels) == 2:
+				e.addResource(block, module, ctx, regions)
+			case block.Type == "module" && len(block.Labels) == 1:
+				e.addModuleCall(block, module, ctx, regions)
+			}
+		}
+	}
+}
+
+func (e *costEstimate) addResource(block *hclsyntax.Block, module costModule, ctx *hcl.EvalContext, regions map[string]string) {
+	address := module.address + block.Labels[0] + "." + block.Labels[1]
+	attributes := resourceAttributes(block.Body, ctx)
+	region := resourceRegion(block, attributes, regions)
+
+	price, found := e.catalog.findPrice(block.Labels[0], region, attributes)
+	quantity := 1.0
+	if found && price.Per != "" {
+		var ok bool
+		if quantity, ok = parseQuantity(attributes[price.Per]); !ok {
+			found = false
+		}
+	}
+	if !found {
+		e.unpriced = append(e.unpriced, address)
+		return
+	}
+
+	instances := resourceInstances(block.Body, ctx) * module.instances
+	description := price.Description
+	if description == "" {
+		description = block.Labels[0]
+	}
+	if instances > 1 {
+		description = fmt.Sprintf("%s (%d instances)", description, instances)
+	}
+	hourlyCost := price.HourlyCost * quantity * float64(instances)
+	e.cost.Resources = append(e.cost.Resources, Resources{
+		HourlyCost:  hourlyCost,
+		Description: description,
+		Currency:    e.catalog.Currency,
+		Resource:    address,
+	})
+	e.cost.TotalCost += hourlyCost
+}
+
+// addModuleCall prices the module a module block calls, found next to the
+// caller for local sources and in .terraform/modules for the others.
+func (e *costEstimate) addModuleCall(block *hclsyntax.Block, caller costModule, ctx *hcl.EvalContext, regions map[string]string) {
+	name := block.Labels[0]
+	address := caller.address + "module." + name
+	key := name
+	if caller.key != "" {
+		key = caller.key + "." + name
+	}
+
+	source, _ := literalString(block.Body, "source")
+	dir, found := caller.installed[key]
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		dir, found = filepath.Join(caller.dir, filepath.FromSlash(source)), true
+	}
+	if !found || len(e.bodiesByDir[dir]) == 0 {
+		e.missing = append(e.missing, address)
+		return
+	}
+	if dir == caller.dir || slices.Contains(caller.callers, dir) {
+		return
+	}
+
+	instances := resourceInstances(block.Body, ctx)
+	if instances == 0 {
+		return
+	}
+	e.addModule(costModule{
+		dir:       dir,
+		address:   address + ".",
+		installed: caller.installed,
+		key:       key,
+		arguments: moduleArguments(block.Body, ctx),
+		instances: caller.instances * instances,
+		regions:   passedProviders(block.Body, regions),
+		callers:   append(slices.Clone(caller.callers), caller.dir),
+	})
+}
+
+// moduleArguments evaluates the variables a module block sets. Values only
+// known after apply are left unknown rather than falling back to defaults.
+func moduleArguments(body *hclsyntax.Body, ctx *hcl.EvalContext) map[string]cty.Value {
+	arguments := map[string]cty.Value{}
+	for attributeName, attr := range body.Attributes {
+		switch attributeName {
+		case "source", "version", "count", "for_each", "providers", "depends_on":
+			continue
+		}
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			value = cty.DynamicVal
+		}
+		arguments[attributeName] = value
+	}
+	return arguments
+}
+
+// passedProviders returns the regions of the providers a module call passes
+// to the module. Like terraform, a call without a providers map passes the
+// default provider configurations, and one with it passes only those listed.
+func passedProviders(body *hclsyntax.Body, regions map[string]string) map[string]string {
+	passed := map[string]string{}
+	attr, exists := body.Attributes["providers"]
+	if !exists {
+		for providerName, region := range regions {
+			if !strings.Contains(providerName, ".") {
+				passed[providerName] = region
+			}
+		}
+		return passed
+	}
+	providers, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return passed
+	}
+	for _, item := range providers.Items {
+		moduleName, moduleOk := providerReference(item.KeyExpr)
+		callerName, callerOk := providerReference(item.ValueExpr)
+		if region, exists := regions[callerName]; moduleOk && callerOk && exists {
+			passed[moduleName] = region
+		}
+	}
+	return passed
+}
+
+// providerReference returns the provider configuration an expression like
+// aws or aws.west refers to.
+func providerReference(expr hcl.Expression) (string, bool) {
+	if key, ok := expr.(*hclsyntax.ObjectConsKeyExpr); ok {
+		expr = key.Wrapped
+	}
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() {
+		return "", false
+	}
+	providerName := traversal.RootName()
+	if len(traversal) > 1 {
+		if step, ok := traversal[1].(hcl.TraverseAttr); ok {
+			providerName += "." + step.Name
+		}
+	}
+	return providerName, true
+}
+
+// moduleEvalContext holds the variables and locals of a module directory,
+// with the arguments of the module call in place of the variable defaults. It
+// also returns the regions of the providers configured there, by local name
+// and alias.
+func moduleEvalContext(collection fileCollection, dir string, isRoot bool, bodies []*hclsyntax.Body, arguments map[string]cty.Value) (ctx *hcl.EvalContext, regions map[string]string) {
+	ctx = &hcl.EvalContext{Variables: map[string]cty.Value{}}
+	variables := map[string]cty.Value{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			variables[block.Labels[0]] = cty.DynamicVal
+			if value, exists := arguments[block.Labels[0]]; exists {
+				variables[block.Labels[0]] = value
+			} else if attr, exists := block.Body.Attributes["default"]; exists {
+				if value, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					variables[block.Labels[0]] = value
+				}
+			}
+		}
+	}
+
+	if isRoot {
+		// terraform.tfvars first, then the .auto.tfvars files in lexical order,
+		// which puts the overrides from --var-file and --var last.
+		var varsFiles []collectedFile
+		for _, file := range collection.files {
+			if isVariablesFile(file.path) && isAutoVariablesFile(file.path) && filepath.Dir(file.path) == dir {
+				varsFiles = append(varsFiles, file)
+			}
+		}
+		sort.SliceStable(varsFiles, func(i, j int) bool {
+			iName, jName := filepath.Base(varsFiles[i].path), filepath.Base(varsFiles[j].path)
+			if (iName == "terraform.tfvars") != (jName == "terraform.tfvars") {
+				return iName == "terraform.tfvars"
+			}
+			return iName < jName
+		})
+		for _, file := range varsFiles {
+			src, err := file.read()
+			if err != nil {
+				continue
+			}
+			varsFile, diags := hclsyntax.ParseConfig(src, file.path, hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				continue
+			}
+			for variableName, attr := range varsFile.Body.(*hclsyntax.Body).Attributes {
+				if value, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					variables[variableName] = value
+				}
+			}
+		}
+	}
+
+	ctx.Variables["var"] = cty.ObjectVal(variables)
+	ctx.Variables["local"] = evaluateLocals(ctx, bodies...)
+
+	regions = map[string]string{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "provider" || len(block.Labels) != 1 {
+				continue
+			}
+			providerName := block.Labels[0]
+			if alias, ok := literalString(block.Body, "alias"); ok {
+				providerName += "." + alias
+			}
+			for _, attributeName := range []string{"region", "location"} {
+				if region, ok := evaluateString(block.Body, attributeName, ctx); ok {
+					regions[providerName] = region
+				}
+			}
+		}
+	}
+	return ctx, regions
+}
+
+// resourceAttributes returns the values of a resource's attributes that can
+// be worked out locally, including those of nested blocks as block.name.
+func resourceAttributes(body *hclsyntax.Body, ctx *hcl.EvalContext) map[string]string {
+	attributes := map[string]string{}
+	add := func(prefix string, body *hclsyntax.Body) {
+		for attributeName, attr := range body.Attributes {
+			value, diags := attr.Expr.Value(ctx)
+			if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+				continue
+			}
+			switch value.Type() {
+			case cty.String:
+				attributes[prefix+attributeName] = value.AsString()
+			case cty.Number:
+				attributes[prefix+attributeName] = value.AsBigFloat().Text('f', -1)
+			case cty.Bool:
+				attributes[prefix+attributeName] = fmt.Sprint(value.True())
+			}
+		}
+	}
+	add("", body)
+	for _, block := range body.Blocks {
+		add(block.Type+".", block.Body)
+	}
+	return attributes
+}
+
+// resourceRegion returns the region a resource is deployed to, from its own
+// region or location, or from the provider configuration it uses.
+func resourceRegion(block *hclsyntax.Block, attributes map[string]string, regions map[string]string) string {
+	for _, attributeName := range []string{"region", "location"} {
+		if region, exists := attributes[attributeName]; exists {
+			return region
+		}
+	}
+	providerName, _, _ := strings.Cut(block.Labels[0], "_")
+	if attr, exists := block.Body.Attributes["provider"]; exists {
+		if reference, ok := providerReference(attr.Expr); ok {
+			providerName = reference
+		}
+	}
+	return regions[providerName]
+}
+
+// resourceInstances returns how many instances count or for_each creates,
+// or 1 when that is only known after apply.
+func resourceInstances(body *hclsyntax.Body, ctx *hcl.EvalContext) int {
+	if attr, exists := body.Attributes["count"]; exists {
+		value, diags := attr.Expr.Value(ctx)
+		if !diags.HasErrors() && value.IsKnown() && !value.IsNull() && value.Type() == cty.Number {
+			if count, accuracy := value.AsBigFloat().Int64(); accuracy == big.Exact && count >= 0 {
+				return int(count)
+			}
+		}
+	}
+	if attr, exists := body.Attributes["for_each"]; exists {
+		value, diags := attr.Expr.Value(ctx)
+		if !diags.HasErrors() && value.IsWhollyKnown() && !value.IsNull() && value.CanIterateElements() {
+			return value.LengthInt()
+		}
+	}
+	return 1
+}
+
+func parseQuantity(value string) (float64, bool) {
+	quantity, ok := new(big.Float).SetString(value)
+	if !ok {
+		return 0, false
+	}
+	result, _ := quantity.Float64()
+	return result, true
+}
+
+func init() {
+
+	costCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
+	costCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to get the auth token from")
+	costCmd.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+	addClientFlags(costCmd)
+	costCmd.Flags().StringVarP(&projectID, "project-id", "", "", "The maze project to get the cost of")
+	costCmd.Flags().BoolVarP(&offline, "offline", "", false, "Estimate the cost locally from --catalog without contacting the server")
+	costCmd.Flags().StringVarP(&catalogPath, "catalog", "", "maze-catalog.json", "The price catalog used by --offline, see maze catalog import")
+	costCmd.Flags().StringSliceVarP(&includeGlobs, "include", "", nil, "Only read files matching these gitignore style patterns")
+	costCmd.Flags().StringSliceVarP(&excludeGlobs, "exclude", "", nil, "Never read files matching these gitignore style patterns")
+	costCmd.Flags().BoolVarP(&useGitignore, "gitignore", "", false, "Also skip files ignored by .gitignore files")
+	costCmd.Flags().BoolVarP(&useInitModules, "init-modules", "", true, "Read the remote modules terraform init installed in .terraform/modules")
+	costCmd.Flags().VarP(variableFlag{"var-file"}, "var-file", "", "Use this variables file, relative to --dir")
+	costCmd.Flags().VarP(variableFlag{"var"}, "var", "", "Set a variable as name=value, like terraform -var")
+	costCmd.Flags().BoolVarP(&skipEnvVars, "no-env-vars", "", false, "Ignore TF_VAR_ environment variables")
+	costCmd.Flags().StringVarP(&outputDir, "output-dir", "", "maze-output", "The folder for results, relative to the terraform directory")
+	costCmd.Flags().Float64VarP(&maxMonthlyCost, "max-monthly-cost", "", 0, "Fail when the monthly cost is above this amount (0 disables the check)")
+	costCmd.Flags().BoolVarP(&skipHistory, "no-history", "", false, "Do not record the run in .maze/history.jsonl")
+
+	costCmd.SetOutput(color.Output)
+
+}
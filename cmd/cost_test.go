@@ -0,0 +1,118 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindPrice(t *testing.T) {
+	catalog := priceCatalog{Prices: []priceEntry{
+		{Resource: "aws_instance", HourlyCost: 1, Description: "any"},
+		{Resource: "aws_instance", Region: "us-east-1", HourlyCost: 2, Description: "region"},
+		{Resource: "aws_instance", Attributes: map[string]string{"instance_type": "t3.micro"}, HourlyCost: 3, Description: "type"},
+		{Resource: "aws_instance", Region: "us-east-1", Attributes: map[string]string{"instance_type": "t3.micro"}, HourlyCost: 4, Description: "region and type"},
+		{Resource: "aws_db_instance", Region: "eu-west-1", HourlyCost: 5, Description: "db"},
+	}}
+	tests := []struct {
+		name       string
+		resource   string
+		region     string
+		attributes map[string]string
+		want       string
+	}{
+		{"only the type matches", "aws_instance", "eu-west-1", map[string]string{"instance_type": "m5.large"}, "any"},
+		{"region beats any", "aws_instance", "us-east-1", nil, "region"},
+		{"attribute beats region", "aws_instance", "eu-west-1", map[string]string{"instance_type": "t3.micro"}, "type"},
+		{"most specific", "aws_instance", "us-east-1", map[string]string{"instance_type": "t3.micro"}, "region and type"},
+		{"other region", "aws_db_instance", "us-east-1", nil, ""},
+		{"unknown type", "aws_s3_bucket", "us-east-1", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			price, found := catalog.findPrice(test.resource, test.region, test.attributes)
+			if found != (test.want != "") || price.Description != test.want {
+				t.Errorf("findPrice = %q, %v, want %q", price.Description, found, test.want)
+			}
+		})
+	}
+}
+
+func TestEstimateCostModules(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"main.tf": `
+provider "aws" {
+  region = "us-east-1"
+}
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+}
+resource "aws_ebs_volume" "data" {
+  size = 10
+}
+module "web" {
+  source = "./modules/app"
+  count  = 2
+  type   = "t3.large"
+}
+module "worker" {
+  source   = "./modules/app"
+  for_each = { a = 1, b = 2, c = 3 }
+  providers = {
+    aws = aws.west
+  }
+}
+module "vpc" {
+  source = "terraform-aws-modules/vpc/aws"
+}
+`,
+		"modules/app/main.tf": `
+variable "type" {
+  default = "t3.micro"
+}
+resource "aws_instance" "this" {
+  instance_type = var.type
+}
+`,
+		"modules/unused/main.tf": `
+resource "aws_instance" "unused" {
+  instance_type = "t3.micro"
+}
+`,
+	})
+	catalog := priceCatalog{Prices: []priceEntry{
+		{Resource: "aws_instance", Region: "us-east-1", Attributes: map[string]string{"instance_type": "t3.large"}, HourlyCost: 1},
+		{Resource: "aws_instance", Region: "us-west-2", Attributes: map[string]string{"instance_type": "t3.micro"}, HourlyCost: 0.5},
+		{Resource: "aws_ebs_volume", HourlyCost: 0.01, Per: "size"},
+	}}
+	var collection fileCollection
+	for _, path := range []string{"main.tf", "modules/app/main.tf", "modules/unused/main.tf"} {
+		collection.files = append(collection.files, collectedFile{path: filepath.Join(root, filepath.FromSlash(path))})
+	}
+
+	cost, unpriced, missing := estimateCost(collection, root, catalog)
+	costs := map[string]float64{}
+	for _, resource := range cost.Resources {
+		costs[resource.Resource] = resource.HourlyCost
+	}
+	want := map[string]float64{
+		"aws_ebs_volume.data":             0.1,
+		"module.web.aws_instance.this":    2,
+		"module.worker.aws_instance.this": 1.5,
+	}
+	if !reflect.DeepEqual(costs, want) {
+		t.Errorf("costs = %v, want %v", costs, want)
+	}
+	if total := roundFloat(cost.TotalCost, 2); total != 3.6 {
+		t.Errorf("total = %v, want 3.6", total)
+	}
+	sort.Strings(missing)
+	if len(unpriced) != 0 || !reflect.DeepEqual(missing, []string{"module.vpc"}) {
+		t.Errorf("unpriced = %v, missing = %v", unpriced, missing)
+	}
+}
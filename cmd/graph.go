@@ -0,0 +1,213 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Resource types that group other resources, from the widest to the
+// narrowest, and the attributes other resources refer to them with.
+var clusterTypes = map[string]int{
+	"azurerm_resource_group":    0,
+	"aws_vpc":                   1,
+	"azurerm_virtual_network":   1,
+	"google_compute_network":    1,
+	"aws_subnet":                2,
+	"azurerm_subnet":            2,
+	"google_compute_subnetwork": 2,
+}
+
+var clusterAttributes = map[string]bool{
+	"resource_group_name":  true,
+	"vpc_id":               true,
+	"virtual_network_name": true,
+	"network":              true,
+	"subnet_id":            true,
+	"subnet_ids":           true,
+	"subnetwork":           true,
+}
+
+// A resource, data source or module call.
+type graphNode struct {
+	address string
+	// Resource type, or module for module calls.
+	kind string
+	// Address of the cluster the node belongs to, if any.
+	parent string
+}
+
+// The resources of the root module and how they refer to each other.
+type resourceGraph struct {
+	nodes map[string]*graphNode
+	// Dependencies of each node, by address.
+	edges map[string][]string
+}
+
+// buildGraph reads the root module's blocks and links them through the
+// references in their expressions, depends_on and module inputs. References
+// to locals are followed to what the locals refer to.
+func buildGraph(files []collectedFile, root string) resourceGraph {
+	graph := resourceGraph{nodes: map[string]*graphNode{}, edges: map[string][]string{}}
+
+	var blocks []*hclsyntax.Block
+	localReferences := map[string][]hcl.Traversal{}
+	for _, file := range files {
+		if !isConfigFile(file.path) || filepath.Dir(file.path) != root {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			continue
+		}
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "locals":
+				for localName, attr := range block.Body.Attributes {
+					localReferences[localName] = attr.Expr.Variables()
+				}
+				continue
+			case "resource", "data":
+				if len(block.Labels) != 2 {
+					continue
+				}
+			case "module":
+				if len(block.Labels) != 1 {
+					continue
+				}
+			default:
+				continue
+			}
+			address, kind := blockAddress(block)
+			graph.nodes[address] = &graphNode{address: address, kind: kind}
+			blocks = append(blocks, block)
+		}
+	}
+
+	// clusterParents holds, for each node, the clusters it refers to through
+	// one of the clusterAttributes.
+	clusterParents := map[string][]string{}
+	for _, block := range blocks {
+		address, _ := blockAddress(block)
+		dependencies := map[string]bool{}
+		var visit func(body *hclsyntax.Body)
+		visit = func(body *hclsyntax.Body) {
+			for attributeName, attr := range body.Attributes {
+				for _, dependency := range resolveReferences(attr.Expr.Variables(), localReferences, graph.nodes, map[string]bool{}) {
+					if dependency == address {
+						continue
+					}
+					dependencies[dependency] = true
+					if clusterAttributes[attributeName] {
+						if _, isCluster := clusterTypes[graph.nodes[dependency].kind]; isCluster {
+							clusterParents[address] = append(clusterParents[address], dependency)
+						}
+					}
+				}
+			}
+			for _, nested := range body.Blocks {
+				visit(nested.Body)
+			}
+		}
+		visit(block.Body)
+		for dependency := range dependencies {
+			graph.edges[address] = append(graph.edges[address], dependency)
+		}
+		sort.Strings(graph.edges[address])
+	}
+
+	// A node goes in the narrowest cluster it refers to.
+	for address, parents := range clusterParents {
+		sort.Slice(parents, func(i, j int) bool {
+			iLevel, jLevel := clusterTypes[graph.nodes[parents[i]].kind], clusterTypes[graph.nodes[parents[j]].kind]
+			if iLevel != jLevel {
+				return iLevel > jLevel
+			}
+			return parents[i] < parents[j]
+		})
+		graph.nodes[address].parent = parents[0]
+	}
+	// Clusters that end up inside each other are drawn side by side instead.
+	for _, node := range graph.nodes {
+		seen := map[string]bool{node.address: true}
+		for parent := node.parent; parent != ""; parent = graph.nodes[parent].parent {
+			if seen[parent] {
+				node.parent = ""
+				break
+			}
+			seen[parent] = true
+		}
+	}
+	return graph
+}
+
+// blockAddress returns the terraform address of a block and its kind.
+func blockAddress(block *hclsyntax.Block) (address string, kind string) {
+	switch block.Type {
+	case "data":
+		return "data." + block.Labels[0] + "." + block.Labels[1], block.Labels[0]
+	case "module":
+		return "module." + block.Labels[0], "module"
+	default:
+		return block.Labels[0] + "." + block.Labels[1], block.Labels[0]
+	}
+}
+
+// resolveReferences returns the graph nodes a set of traversals refers to,
+// looking through locals.
+func resolveReferences(traversals []hcl.Traversal, localReferences map[string][]hcl.Traversal, nodes map[string]*graphNode, seenLocals map[string]bool) (addresses []string) {
+	for _, traversal := range traversals {
+		var parts []string
+		parts = append(parts, traversal.RootName())
+		for _, step := range traversal[1:] {
+			if attr, ok := step.(hcl.TraverseAttr); ok {
+				parts = append(parts, attr.Name)
+			} else {
+				break
+			}
+		}
+
+		switch {
+		case parts[0] == "local" && len(parts) > 1:
+			if !seenLocals[parts[1]] {
+				seenLocals[parts[1]] = true
+				addresses = append(addresses, resolveReferences(localReferences[parts[1]], localReferences, nodes, seenLocals)...)
+			}
+		case parts[0] == "data" && len(parts) > 2:
+			if address := strings.Join(parts[:3], "."); nodes[address] != nil {
+				addresses = append(addresses, address)
+			}
+		case len(parts) > 1:
+			if address := strings.Join(parts[:2], "."); nodes[address] != nil {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+// sortedAddresses returns the addresses of every node in order.
+func (g resourceGraph) sortedAddresses() []string {
+	addresses := make([]string, 0, len(g.nodes))
+	for address := range g.nodes {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// children returns the nodes directly inside each cluster, with the nodes
+// outside of any cluster under the empty address.
+func (g resourceGraph) children() map[string][]string {
+	children := map[string][]string{}
+	for _, address := range g.sortedAddresses() {
+		children[g.nodes[address].parent] = append(children[g.nodes[address].parent], address)
+	}
+	return children
+}
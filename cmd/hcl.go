@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parseHCLFile parses a terraform file in native syntax.
+func parseHCLFile(path string) (*hclsyntax.Body, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// literalString returns the value of an attribute when it is a plain string
+// that needs no variables or functions to evaluate.
+func literalString(body *hclsyntax.Body, name string) (string, bool) {
+	attr, exists := body.Attributes[name]
+	if !exists {
+		return "", false
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// localModuleSources returns the source of every module block that refers to
+// a directory on disk rather than a registry or remote module.
+func localModuleSources(body *hclsyntax.Body) (sources []string) {
+	for _, block := range body.Blocks {
+		if block.Type != "module" {
+			continue
+		}
+		source, ok := literalString(block.Body, "source")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+			sources = append(sources, source)
+		}
+	}
+	return
+}
@@ -0,0 +1,337 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// Where the metrics of every run are appended, relative to --dir.
+var historyFilePath = filepath.Join(".maze", "history.jsonl")
+
+var (
+	skipHistory  bool
+	historyLimit int
+)
+
+// The key metrics of one plan, comply or cost run. Metrics the run did not
+// measure are left out.
+type historyEntry struct {
+	Time          time.Time `json:"time"`
+	Command       string    `json:"command"`
+	Commit        string    `json:"commit,omitempty"`
+	ProjectID     string    `json:"project_id,omitempty"`
+	MonthlyCost   *float64  `json:"monthly_cost,omitempty"`
+	PassedChecks  *int      `json:"passed_checks,omitempty"`
+	FailedChecks  *int      `json:"failed_checks,omitempty"`
+	ResourceCount *int      `json:"resource_count,omitempty"`
+}
+
+// A metric shown in the trends, read from a history entry.
+type historyMetric struct {
+	label string
+	value func(entry historyEntry) *float64
+	// Whether a higher value than the previous run is a regression.
+	regressesUp bool
+	format      func(value float64) string
+}
+
+var historyMetrics = []historyMetric{
+	{"Monthly cost", func(entry historyEntry) *float64 { return entry.MonthlyCost }, true, formatDollars},
+	{"Failed checks", func(entry historyEntry) *float64 { return intMetric(entry.FailedChecks) }, true, formatCount},
+	{"Passed checks", func(entry historyEntry) *float64 { return intMetric(entry.PassedChecks) }, false, formatCount},
+	{"Resources", func(entry historyEntry) *float64 { return intMetric(entry.ResourceCount) }, false, formatCount},
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: ux.ShortTextHistory,
+	Long:  ux.LongTextHistory,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := showHistory(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func historyPath() string {
+	return filepath.Join(dirPath, historyFilePath)
+}
+
+// newHistoryEntry starts the history entry of a run at the current commit.
+func newHistoryEntry(command string) historyEntry {
+	return historyEntry{Time: time.Now().UTC(), Command: command, Commit: gitCommit()}
+}
+
+// gitCommit returns the commit checked out in --dir, or nothing outside a
+// git repository.
+func gitCommit() string {
+	out, err := exec.Command("git", "-C", dirPath, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// addCompliance records the compliance summary, unless testing failed before
+// any check was counted.
+func (e *historyEntry) addCompliance(data Response) {
+	summary := data.Summary
+	if summary.Passed+summary.Failed+summary.Skipped == 0 && len(data.Results.FailedChecks) == 0 {
+		return
+	}
+	e.PassedChecks = &summary.Passed
+	e.FailedChecks = &summary.Failed
+	if summary.ResourceCount > 0 {
+		e.ResourceCount = &summary.ResourceCount
+	}
+}
+
+// addCost records the monthly cost, and the priced resources when the
+// resource count is not known yet.
+func (e *historyEntry) addCost(cost Cost) {
+	monthly := roundFloat(cost.TotalCost*730, 2)
+	e.MonthlyCost = &monthly
+	if e.ResourceCount == nil {
+		count := len(cost.Resources)
+		e.ResourceCount = &count
+	}
+}
+
+// recordRun appends a run to the history file unless --no-history is given.
+func recordRun(entry historyEntry) {
+	if skipHistory {
+		return
+	}
+	if err := appendHistory(entry); err != nil {
+		fmt.Println("Could not record the run in the history:", err)
+	}
+}
+
+func appendHistory(entry historyEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(historyPath()), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(historyPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadHistory reads the recorded runs, oldest first.
+func loadHistory() (entries []historyEntry, err error) {
+	file, err := os.Open(historyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("could not parse %s:%d: %w", historyPath(), line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func showHistory() error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No runs recorded in %s yet, run maze plan, comply or cost first\n", historyPath())
+		return nil
+	}
+	// Runs before the shown ones still count as the previous run.
+	start := 0
+	if historyLimit > 0 && len(entries) > historyLimit {
+		start = len(entries) - historyLimit
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("DATE")+"\t"+ux.BlueColor("COMMAND")+"\t"+ux.BlueColor("COMMIT")+"\t"+ux.BlueColor("PROJECT")+"\t"+
+		ux.BlueColor("MONTHLY COST")+"\t"+ux.BlueColor("FAILED")+"\t"+ux.BlueColor("PASSED")+"\t"+ux.BlueColor("RESOURCES"))
+	for i, entry := range entries[start:] {
+		cells := []string{entry.Time.Local().Format("2006-01-02 15:04"), entry.Command, orDash(entry.Commit), orDash(entry.ProjectID)}
+		for _, metric := range historyMetrics {
+			cell := "-"
+			if value := metric.value(entry); value != nil {
+				cell = metric.format(*value)
+				if previous := previousValue(entries[:start+i], entry.Command, metric); previous != nil && metric.regressed(*previous, *value) {
+					cell += " ↑"
+				}
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Trends:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, metric := range historyMetrics {
+		for _, series := range metricSeries(entries[start:], metric) {
+			fmt.Fprintf(w, "    %s\t%s\t%s\t%s\n", metric.label, series.command, sparkline(series.values), metric.format(series.values[len(series.values)-1]))
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	latest := entries[len(entries)-1]
+	regressions := 0
+	for _, metric := range historyMetrics {
+		value := metric.value(latest)
+		previous := previousValue(entries[:len(entries)-1], latest.Command, metric)
+		if value == nil || previous == nil || !metric.regressed(*previous, *value) {
+			continue
+		}
+		regressions++
+		fmt.Printf("%s %s went up from %s to %s since the previous %s run\n", ux.PrintRed("✘"), metric.label, metric.format(*previous), metric.format(*value), latest.Command)
+	}
+	if regressions == 0 {
+		fmt.Printf("%s No regressions since the previous %s run\n", ux.PrintGreen("✔"), latest.Command)
+	}
+	return nil
+}
+
+// The values of a metric measured by the runs of one command, oldest first.
+type historySeries struct {
+	command string
+	values  []float64
+}
+
+// metricSeries splits the values of a metric by command, in the order the
+// commands first ran, so a trend never mixes the server's numbers with local
+// rules or estimates.
+func metricSeries(entries []historyEntry, metric historyMetric) (series []historySeries) {
+	byCommand := map[string]int{}
+	for _, entry := range entries {
+		value := metric.value(entry)
+		if value == nil {
+			continue
+		}
+		i, exists := byCommand[entry.Command]
+		if !exists {
+			i = len(series)
+			byCommand[entry.Command] = i
+			series = append(series, historySeries{command: entry.Command})
+		}
+		series[i].values = append(series[i].values, *value)
+	}
+	return series
+}
+
+// previousValue returns the metric of the latest of entries that ran the same
+// command and measured it. Runs of other commands are not compared, as local
+// rules and estimates differ from what the server reports.
+func previousValue(entries []historyEntry, command string, metric historyMetric) *float64 {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Command != command {
+			continue
+		}
+		if value := metric.value(entries[i]); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func (m historyMetric) regressed(previous float64, value float64) bool {
+	return m.regressesUp && value > previous
+}
+
+// sparkline draws values as a row of bars scaled between their minimum and
+// maximum.
+func sparkline(values []float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	low, high := values[0], values[0]
+	for _, value := range values {
+		low = min(low, value)
+		high = max(high, value)
+	}
+	var line strings.Builder
+	for _, value := range values {
+		bar := 0
+		if high > low {
+			bar = int((value - low) / (high - low) * float64(len(bars)-1))
+		}
+		line.WriteRune(bars[bar])
+	}
+	return line.String()
+}
+
+func intMetric(value *int) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := float64(*value)
+	return &converted
+}
+
+func formatDollars(value float64) string {
+	return "$" + strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+func formatCount(value float64) string {
+	return strconv.Itoa(int(value))
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+
+	historyCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "", 20, "How many of the latest runs to show (0 shows all)")
+
+	historyCmd.SetOutput(color.Output)
+
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetricSeries(t *testing.T) {
+	cost := func(value float64) *float64 { return &value }
+	count := func(value int) *int { return &value }
+	entries := []historyEntry{
+		{Command: "plan", MonthlyCost: cost(10), FailedChecks: count(3)},
+		{Command: "comply --local", FailedChecks: count(7)},
+		{Command: "cost --offline", MonthlyCost: cost(12)},
+		{Command: "plan", MonthlyCost: cost(11), FailedChecks: count(2)},
+		{Command: "comply --local", FailedChecks: count(5)},
+	}
+	tests := []struct {
+		metric string
+		want   []historySeries
+	}{
+		{"Monthly cost", []historySeries{{"plan", []float64{10, 11}}, {"cost --offline", []float64{12}}}},
+		{"Failed checks", []historySeries{{"plan", []float64{3, 2}}, {"comply --local", []float64{7, 5}}}},
+		{"Resources", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.metric, func(t *testing.T) {
+			for _, metric := range historyMetrics {
+				if metric.label != test.metric {
+					continue
+				}
+				if series := metricSeries(entries, metric); !reflect.DeepEqual(series, test.want) {
+					t.Errorf("series = %v, want %v", series, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   string
+	}{
+		{[]float64{1}, "▁"},
+		{[]float64{5, 5, 5}, "▁▁▁"},
+		{[]float64{0, 7}, "▁█"},
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+	}
+	for _, test := range tests {
+		if line := sparkline(test.values); line != test.want {
+			t.Errorf("sparkline(%v) = %q, want %q", test.values, line, test.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Name of the file listing paths that should never be uploaded.
+const mazeIgnoreName = ".mazeignore"
+
+// A single pattern from an ignore file, following gitignore semantics.
+type ignorePattern struct {
+	base    string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// ignoreMatcher decides which paths are skipped during file collection. Rules
+// are kept in the order they were read so the last matching one wins, and the
+// --exclude globs are checked after every ignore file.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+	exclude  []ignorePattern
+	include  []ignorePattern
+}
+
+// newIgnoreMatcher creates a matcher for the --include and --exclude globs.
+// Both are anchored at the terraform directory.
+func newIgnoreMatcher(include []string, exclude []string) *ignoreMatcher {
+	matcher := &ignoreMatcher{}
+	for _, line := range include {
+		if pattern, ok := parseIgnorePattern("", line); ok {
+			matcher.include = append(matcher.include, pattern)
+		}
+	}
+	for _, line := range exclude {
+		if pattern, ok := parseIgnorePattern("", line); ok {
+			matcher.exclude = append(matcher.exclude, pattern)
+		}
+	}
+	return matcher
+}
+
+// loadDir reads the ignore files found in a directory. relativeDir is the
+// directory relative to the terraform directory, using forward slashes.
+func (m *ignoreMatcher) loadDir(dir string, relativeDir string, useGitignore bool) error {
+	names := []string{mazeIgnoreName}
+	if useGitignore {
+		names = []string{".gitignore", mazeIgnoreName}
+	}
+	for _, ignoreName := range names {
+		file, err := os.Open(filepath.Join(dir, ignoreName))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if pattern, ok := parseIgnorePattern(relativeDir, scanner.Text()); ok {
+				m.patterns = append(m.patterns, pattern)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignored reports whether a path relative to the terraform directory should
+// be skipped.
+func (m *ignoreMatcher) ignored(relativePath string, isDir bool) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	ignored := false
+	for _, pattern := range m.patterns {
+		if pattern.matches(relativePath, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	for _, pattern := range m.exclude {
+		if pattern.matches(relativePath, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	if ignored || isDir || len(m.include) == 0 {
+		return ignored
+	}
+
+	included := false
+	for _, pattern := range m.include {
+		if pattern.matches(relativePath, isDir) {
+			included = !pattern.negate
+		}
+	}
+	return !included
+}
+
+func (p ignorePattern) matches(relativePath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relativePath, p.base+"/") {
+			return false
+		}
+		relativePath = strings.TrimPrefix(relativePath, p.base+"/")
+	}
+	return p.re.MatchString(relativePath)
+}
+
+// parseIgnorePattern converts a line of an ignore file into a pattern. It
+// returns false for blank lines and comments.
+func parseIgnorePattern(base string, line string) (pattern ignorePattern, ok bool) {
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern, false
+	}
+
+	pattern.base = base
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern, false
+	}
+
+	// A slash at the start or in the middle anchors the pattern to the
+	// directory holding the ignore file.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return pattern, false
+	}
+	pattern.re = re
+	return pattern, true
+}
+
+// globToRegexp translates a gitignore glob, including "**", into a regular
+// expression body.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString("\\[")
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
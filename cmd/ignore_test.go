@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		line    string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"name anywhere", "", "secret.tfvars", "envs/prod/secret.tfvars", false, true},
+		{"star", "", "*.tfstate", "terraform.tfstate", false, true},
+		{"star stays in its segment", "", "envs/*.tf", "envs/prod/main.tf", false, false},
+		{"anchored with leading slash", "", "/main.tf", "modules/main.tf", false, false},
+		{"anchored by inner slash", "", "envs/prod", "envs/prod", true, true},
+		{"anchored inner slash elsewhere", "", "envs/prod", "other/envs/prod", true, false},
+		{"double star prefix", "", "**/fixtures", "a/b/fixtures", true, true},
+		{"double star middle", "", "modules/**/test.tf", "modules/a/b/test.tf", false, true},
+		{"double star suffix", "", "examples/**", "examples/a/main.tf", false, true},
+		{"directory only on a file", "", "build/", "build", false, false},
+		{"directory only on a directory", "", "build/", "build", true, true},
+		{"question mark", "", "v?.tf", "v1.tf", false, true},
+		{"character class", "", "env[0-9].tf", "env7.tf", false, true},
+		{"negated character class", "", "env[!0-9].tf", "env7.tf", false, false},
+		{"escaped hash", "", "\\#notes.tf", "#notes.tf", false, true},
+		{"relative to its directory", "envs", "local.tf", "envs/prod/local.tf", false, true},
+		{"outside its directory", "envs", "local.tf", "local.tf", false, false},
+		{"trailing spaces", "", "main.tf  ", "main.tf", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern, ok := parseIgnorePattern(test.base, test.line)
+			if !ok {
+				t.Fatalf("parseIgnorePattern(%q) was skipped", test.line)
+			}
+			if got := pattern.matches(test.path, test.isDir); got != test.matches {
+				t.Errorf("%q matches %q = %v, want %v", test.line, test.path, got, test.matches)
+			}
+		})
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "!", "/"} {
+		if _, ok := parseIgnorePattern("", line); ok {
+			t.Errorf("parseIgnorePattern(%q) should be skipped", line)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		".mazeignore":      "*.tfvars\n!shared.tfvars\nscratch/\n",
+		".gitignore":       "*.tfstate\n",
+		"envs/.mazeignore": "prod.tf\n",
+	})
+	tests := []struct {
+		name         string
+		include      []string
+		exclude      []string
+		useGitignore bool
+		path         string
+		isDir        bool
+		ignored      bool
+	}{
+		{"plain file", nil, nil, false, "main.tf", false, false},
+		{"ignored by .mazeignore", nil, nil, false, "prod.tfvars", false, true},
+		{"negated later", nil, nil, false, "shared.tfvars", false, false},
+		{"ignored directory", nil, nil, false, "scratch", true, true},
+		{"nested ignore file", nil, nil, false, "envs/prod.tf", false, true},
+		{"nested ignore file elsewhere", nil, nil, false, "prod.tf", false, false},
+		{".gitignore off", nil, nil, false, "terraform.tfstate", false, false},
+		{".gitignore on", nil, nil, true, "terraform.tfstate", false, true},
+		{"exclude wins over a negation", nil, []string{"shared.tfvars"}, false, "shared.tfvars", false, true},
+		{"exclude can be negated", nil, []string{"*.tf", "!main.tf"}, false, "main.tf", false, false},
+		{"include keeps matches", []string{"*.tf"}, nil, false, "main.tf", false, false},
+		{"include drops the rest", []string{"*.tf"}, nil, false, "shared.tfvars", false, true},
+		{"include does not stop walking directories", []string{"*.tf"}, nil, false, "modules", true, false},
+		{"include cannot bring back ignored files", []string{"*.tfvars"}, nil, false, "prod.tfvars", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher := newIgnoreMatcher(test.include, test.exclude)
+			if err := matcher.loadDir(root, "", test.useGitignore); err != nil {
+				t.Fatal(err)
+			}
+			if err := matcher.loadDir(filepath.Join(root, "envs"), "envs", test.useGitignore); err != nil {
+				t.Fatal(err)
+			}
+			if got := matcher.ignored(test.path, test.isDir); got != test.ignored {
+				t.Errorf("ignored(%q) = %v, want %v", test.path, got, test.ignored)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	imageFormat string
+	imageWidth  int
+	imageTheme  string
+	imageOut    string
+)
+
+// checkImageOptions validates the canvas image flags.
+func checkImageOptions() error {
+	if imageFormat != "png" && imageFormat != "svg" && imageFormat != "pdf" {
+		return errors.New("image format needs to be one of png, svg or pdf")
+	}
+	if imageTheme != "light" && imageTheme != "dark" {
+		return errors.New("theme needs to be one of light or dark")
+	}
+	if imageWidth < 0 {
+		return errors.New("image width cannot be negative")
+	}
+	return nil
+}
+
+// imagePath returns where the canvas image is saved: --image-out, or a file
+// in the output folder named after the format.
+func imagePath() string {
+	if imageOut != "" {
+		return imageOut
+	}
+	return outputPath("maze_canvas_image." + imageFormat)
+}
+
+// imageQuery returns the query string asking the canvas image endpoint for
+// the selected format, width and theme.
+func imageQuery() string {
+	query := neturl.Values{}
+	query.Set("format", imageFormat)
+	query.Set("theme", imageTheme)
+	if imageWidth > 0 {
+		query.Set("width", strconv.Itoa(imageWidth))
+	}
+	return query.Encode()
+}
+
+// decodeImage returns the image in a canvas image response, which is either
+// the file itself or its base64 encoding, optionally as a JSON string or a
+// data URL. It fails unless the content starts like a file of the format.
+func decodeImage(body []byte, format string) ([]byte, error) {
+	if isImageFormat(body, format) {
+		return body, nil
+	}
+	encoded := strings.TrimSpace(string(body))
+	var quoted string
+	if json.Unmarshal([]byte(encoded), &quoted) == nil {
+		encoded = quoted
+	}
+	if strings.HasPrefix(encoded, "data:") {
+		if _, data, found := strings.Cut(encoded, ","); found {
+			encoded = data
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("the server did not send a %s image", format)
+	}
+	if !isImageFormat(decoded, format) {
+		return nil, fmt.Errorf("the server did not send a %s image", format)
+	}
+	return decoded, nil
+}
+
+// isImageFormat checks the magic bytes of an image.
+func isImageFormat(data []byte, format string) bool {
+	switch format {
+	case "png":
+		return bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n"))
+	case "pdf":
+		return bytes.HasPrefix(data, []byte("%PDF-"))
+	case "svg":
+		data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+		if bytes.HasPrefix(data, []byte("<?xml")) || bytes.HasPrefix(data, []byte("<!DOCTYPE")) {
+			head := data
+			if len(head) > 1024 {
+				head = head[:1024]
+			}
+			return bytes.Contains(head, []byte("<svg"))
+		}
+		return bytes.HasPrefix(data, []byte("<svg"))
+	}
+	return false
+}
+
+// serverMessage returns the error message in a response body, reading the
+// usual JSON fields and shortening plain text.
+func serverMessage(body []byte) string {
+	var decoded map[string]interface{}
+	if json.Unmarshal(body, &decoded) == nil {
+		for _, key := range []string{"message", "error", "detail"} {
+			if message, ok := decoded[key].(string); ok && message != "" {
+				return message
+			}
+		}
+	}
+	message := strings.Join(strings.Fields(string(body)), " ")
+	if strings.HasPrefix(message, "<") {
+		// An HTML error page says nothing the status does not.
+		return ""
+	}
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	return message
+}
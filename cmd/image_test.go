@@ -0,0 +1,106 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	testPDF = []byte("%PDF-1.7\n%%EOF")
+	testSVG = []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+)
+
+func TestIsImageFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   bool
+	}{
+		{"png", testPNG, "png", true},
+		{"pdf", testPDF, "pdf", true},
+		{"svg", testSVG, "svg", true},
+		{"svg with xml declaration", []byte("<?xml version=\"1.0\"?>\n<svg></svg>"), "svg", true},
+		{"svg with doctype", []byte("<!DOCTYPE svg>\n<svg></svg>"), "svg", true},
+		{"svg with bom and spaces", append([]byte("\xef\xbb\xbf \n"), testSVG...), "svg", true},
+		{"svg tag too far into the file", []byte("<?xml version=\"1.0\"?>" + strings.Repeat(" ", 2048) + "<svg></svg>"), "svg", false},
+		{"xml that is not svg", []byte("<?xml version=\"1.0\"?><html></html>"), "svg", false},
+		{"html error page", []byte("<html>Bad gateway</html>"), "svg", false},
+		{"png asked as pdf", testPNG, "pdf", false},
+		{"base64 png", []byte(base64.StdEncoding.EncodeToString(testPNG)), "png", false},
+		{"unknown format", testPNG, "gif", false},
+		{"empty", nil, "png", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isImageFormat(test.data, test.format); got != test.want {
+				t.Errorf("isImageFormat = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testPNG)
+	tests := []struct {
+		name    string
+		body    string
+		format  string
+		want    []byte
+		wantErr bool
+	}{
+		{"raw png", string(testPNG), "png", testPNG, false},
+		{"raw svg", string(testSVG), "svg", testSVG, false},
+		{"base64", encoded, "png", testPNG, false},
+		{"base64 with newline", encoded + "\n", "png", testPNG, false},
+		{"json string", `"` + encoded + `"`, "png", testPNG, false},
+		{"data url", "data:image/png;base64," + encoded, "png", testPNG, false},
+		{"data url in json", `"data:image/png;base64,` + encoded + `"`, "png", testPNG, false},
+		{"base64 pdf", base64.StdEncoding.EncodeToString(testPDF), "pdf", testPDF, false},
+		{"wrong format", encoded, "pdf", nil, true},
+		{"json error", `{"error": "not found"}`, "png", nil, true},
+		{"html page", "<html>Bad gateway</html>", "png", nil, true},
+		{"empty", "", "png", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image, err := decodeImage([]byte(test.body), test.format)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want an error: %v", err, test.wantErr)
+			}
+			if !bytes.Equal(image, test.want) {
+				t.Errorf("image = %q, want %q", image, test.want)
+			}
+		})
+	}
+}
+
+func TestServerMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"message field", `{"message": "project not found"}`, "project not found"},
+		{"error field", `{"error": "unauthorized", "code": 401}`, "unauthorized"},
+		{"detail field", `{"detail": "rate limited"}`, "rate limited"},
+		{"empty message falls through", `{"message": "", "error": "bad request"}`, "bad request"},
+		{"plain text", "  upstream\n timed out ", "upstream timed out"},
+		{"html page", "<html><body>502</body></html>", ""},
+		{"long text", strings.Repeat("a", 250), strings.Repeat("a", 200) + "..."},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := serverMessage([]byte(test.body)); got != test.want {
+				t.Errorf("serverMessage = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var inventoryFormat string
+
+// Something declared in the terraform files.
+type inventoryItem struct {
+	// resource, data, module, variable, output or provider.
+	Kind string `json:"kind"`
+	// Resource or data source type, module source or provider name.
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// How many blocks of a kind and type were found.
+type inventoryCount struct {
+	Kind  string `json:"kind"`
+	Type  string `json:"type,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Everything declared in the collected files, with counts per kind and type.
+type inventory struct {
+	Items  []inventoryItem  `json:"items"`
+	Counts []inventoryCount `json:"counts"`
+}
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: ux.ShortTextInventory,
+	Long:  ux.LongTextInventory,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := mazeInventory(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func mazeInventory() error {
+	if inventoryFormat != "table" && inventoryFormat != "json" && inventoryFormat != "csv" {
+		return errors.New("format needs to be one of table, json or csv")
+	}
+	collection, err := collectFiles()
+	if err != nil {
+		return err
+	}
+	found := buildInventory(collection.files)
+
+	switch inventoryFormat {
+	case "json":
+		data, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"kind", "type", "name", "file", "line"})
+		for _, item := range found.Items {
+			w.Write([]string{item.Kind, item.Type, item.Name, item.File, strconv.Itoa(item.Line)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		printInventory(found)
+	}
+	return nil
+}
+
+// buildInventory lists the blocks declared in the collected terraform files.
+// Files that do not parse are skipped, as the server reports their errors.
+func buildInventory(files []collectedFile) (found inventory) {
+	found.Items = []inventoryItem{}
+	counts := map[inventoryCount]int{}
+	for _, file := range files {
+		if !isConfigFile(file.path) {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			continue
+		}
+		for _, block := range body.Blocks {
+			item := inventoryItem{Kind: block.Type, File: file.relativePath, Line: block.DefRange().Start.Line}
+			switch block.Type {
+			case "resource", "data":
+				if len(block.Labels) != 2 {
+					continue
+				}
+				item.Type, item.Name = block.Labels[0], block.Labels[1]
+			case "module":
+				if len(block.Labels) != 1 {
+					continue
+				}
+				item.Name = block.Labels[0]
+				item.Type, _ = literalString(block.Body, "source")
+			case "provider":
+				if len(block.Labels) != 1 {
+					continue
+				}
+				item.Type, item.Name = block.Labels[0], block.Labels[0]
+				if alias, ok := literalString(block.Body, "alias"); ok {
+					item.Name = block.Labels[0] + "." + alias
+				}
+			case "variable", "output":
+				if len(block.Labels) != 1 {
+					continue
+				}
+				item.Name = block.Labels[0]
+			default:
+				continue
+			}
+			found.Items = append(found.Items, item)
+			// Variables and outputs have no type and are counted per kind.
+			key := inventoryCount{Kind: item.Kind}
+			if item.Kind != "variable" && item.Kind != "output" {
+				key.Type = item.Type
+			}
+			counts[key]++
+		}
+	}
+
+	sort.SliceStable(found.Items, func(i, j int) bool {
+		if found.Items[i].File != found.Items[j].File {
+			return found.Items[i].File < found.Items[j].File
+		}
+		return found.Items[i].Line < found.Items[j].Line
+	})
+
+	found.Counts = []inventoryCount{}
+	for key, count := range counts {
+		key.Count = count
+		found.Counts = append(found.Counts, key)
+	}
+	sort.Slice(found.Counts, func(i, j int) bool {
+		if found.Counts[i].Kind != found.Counts[j].Kind {
+			return found.Counts[i].Kind < found.Counts[j].Kind
+		}
+		return found.Counts[i].Type < found.Counts[j].Type
+	})
+	return found
+}
+
+func printInventory(found inventory) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("KIND")+"\t"+ux.BlueColor("TYPE")+"\t"+ux.BlueColor("NAME")+"\t"+ux.BlueColor("LOCATION"))
+	for _, item := range found.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s:%d\n", item.Kind, item.Type, item.Name, item.File, item.Line)
+	}
+	w.Flush()
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("KIND")+"\t"+ux.BlueColor("TYPE")+"\t"+ux.BlueColor("COUNT"))
+	for _, count := range found.Counts {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", count.Kind, count.Type, count.Count)
+	}
+	w.Flush()
+}
+
+func init() {
+
+	inventoryCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
+	inventoryCmd.Flags().StringVarP(&inventoryFormat, "format", "f", "table", "Output format: table, json or csv")
+	inventoryCmd.Flags().StringSliceVarP(&includeGlobs, "include", "", nil, "Only read files matching these gitignore style patterns")
+	inventoryCmd.Flags().StringSliceVarP(&excludeGlobs, "exclude", "", nil, "Never read files matching these gitignore style patterns")
+	inventoryCmd.Flags().BoolVarP(&useGitignore, "gitignore", "", false, "Also skip files ignored by .gitignore files")
+	inventoryCmd.Flags().BoolVarP(&useInitModules, "init-modules", "", true, "Read the remote modules terraform init installed in .terraform/modules")
+	inventoryCmd.Flags().StringVarP(&iacMode, "iac", "", "auto", "The kind of code in --dir: terraform, opentofu, terragrunt, or auto to detect it")
+	inventoryCmd.Flags().StringVarP(&outputDir, "output-dir", "", "maze-output", "The folder for results, relative to the terraform directory")
+
+	inventoryCmd.SetOutput(color.Output)
+
+}
@@ -0,0 +1,324 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+const deviceGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	clientID  string
+	deviceURL string
+	tokenURL  string
+	revokeURL string
+	noBrowser bool
+)
+
+// Device authorization response as described in RFC 8628.
+type deviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Token endpoint response, successful or not.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// loginCmd represents the login command
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: ux.ShortTextLogin,
+	Long:  ux.LongTextLogin,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := mazeLogin(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: ux.ShortTextLogout,
+	Long:  ux.LongTextLogout,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := mazeLogout(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func mazeLogin() error {
+	style := color.New()
+	style.AddRGB(5, 98, 254)
+	style.Add(color.Bold)
+	fmt.Println()
+	style.Printf(ux.MazeLogo)
+
+	if deviceURL == "" {
+		deviceURL = url + "/api/oauth/device/code"
+	}
+	if tokenURL == "" {
+		tokenURL = url + "/api/oauth/token"
+	}
+	if revokeURL == "" {
+		revokeURL = url + "/api/oauth/revoke"
+	}
+
+	code, err := requestDeviceCode()
+	if err != nil {
+		return fmt.Errorf("could not start login: %w", err)
+	}
+
+	verificationURI := code.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = code.VerificationURI
+	}
+	fmt.Println("To log in, open this url in your browser:")
+	style.Println("----------------------------------------------------------------------")
+	fmt.Println(verificationURI)
+	style.Println("----------------------------------------------------------------------")
+	fmt.Printf("and confirm the code: %s\n\n", style.Sprint(code.UserCode))
+	if !noBrowser {
+		ux.OpenBrowser(verificationURI)
+	}
+
+	var loginSpinner = ux.NewSpinner("Waiting for confirmation", "Logged in", "Login failed", false)
+	loginSpinner.Start()
+	tokens, err := pollDeviceToken(code)
+	if err != nil {
+		loginSpinner.Fail()
+		return err
+	}
+	loginSpinner.Success()
+
+	profile := ux.Profile{
+		ProfileName:  profileName,
+		AuthToken:    tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		RefreshToken: tokens.RefreshToken,
+		TokenURL:     tokenURL,
+		RevokeURL:    revokeURL,
+		ClientID:     clientID,
+	}
+	if err := ux.SaveProfile(profile); err != nil {
+		return fmt.Errorf("could not save the profile: %w", err)
+	}
+	return nil
+}
+
+func mazeLogout() error {
+	profile, err := ux.GetProfile(profileName)
+	if err != nil {
+		return err
+	}
+
+	if profile.RevokeURL != "" {
+		var logoutSpinner = ux.NewSpinner("Revoking tokens", "Tokens revoked", "Token revocation failed", false)
+		logoutSpinner.Start()
+		revokeErr := revokeToken(profile, profile.RefreshToken, "refresh_token")
+		if err := revokeToken(profile, profile.AuthToken, "access_token"); err != nil && revokeErr == nil {
+			revokeErr = err
+		}
+		if revokeErr != nil {
+			logoutSpinner.Fail()
+			fmt.Println(revokeErr)
+		} else {
+			logoutSpinner.Success()
+		}
+	}
+
+	return ux.DeleteProfile(profileName)
+}
+
+// requestDeviceCode starts the device authorization flow.
+func requestDeviceCode() (code deviceCode, err error) {
+	resp, err := httpClient().PostForm(deviceURL, neturl.Values{"client_id": {clientID}})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return code, fmt.Errorf("device authorization returned %s", resp.Status)
+	}
+	if err = json.Unmarshal(bodyBytes, &code); err != nil {
+		return
+	}
+	if code.DeviceCode == "" || code.VerificationURI == "" {
+		return code, errors.New("device authorization response is missing the device code or verification url")
+	}
+	return
+}
+
+// pollDeviceToken polls the token endpoint until the user approves or denies
+// the login, or the device code expires.
+func pollDeviceToken(code deviceCode) (tokens tokenResponse, err error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(code.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 10 * time.Minute
+	}
+	deadline := time.Now().Add(expiresIn)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tokens, err = requestToken(tokenURL, neturl.Values{
+			"grant_type":  {deviceGrant},
+			"device_code": {code.DeviceCode},
+			"client_id":   {clientID},
+		})
+		if err != nil {
+			return
+		}
+
+		switch tokens.Error {
+		case "":
+			return
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return tokens, errors.New("the login request was denied")
+		case "expired_token":
+			return tokens, errors.New("the login code expired, run maze login again")
+		default:
+			return tokens, fmt.Errorf("login failed: %s %s", tokens.Error, tokens.ErrorDescription)
+		}
+	}
+	return tokens, errors.New("the login code expired, run maze login again")
+}
+
+// requestToken posts a form to a token endpoint. OAuth errors are returned in
+// the Error field rather than as err so callers can react to them.
+func requestToken(endpoint string, form neturl.Values) (tokens tokenResponse, err error) {
+	resp, err := httpClient().PostForm(endpoint, form)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(bodyBytes, &tokens); err != nil {
+		return tokens, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if tokens.Error == "" && (resp.StatusCode != http.StatusOK || tokens.AccessToken == "") {
+		return tokens, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	return
+}
+
+// refreshAuthToken exchanges the stored refresh token for a new access token,
+// saves it to the selected profile and makes it the token used by requests.
+func refreshAuthToken() error {
+	profile, err := ux.GetProfile(profileName)
+	if err != nil {
+		return err
+	}
+	if profile.RefreshToken == "" || profile.TokenURL == "" {
+		return errors.New("profile has no refresh token, run maze login")
+	}
+
+	tokens, err := requestToken(profile.TokenURL, neturl.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {profile.RefreshToken},
+		"client_id":     {profile.ClientID},
+	})
+	if err != nil {
+		return err
+	}
+	if tokens.Error != "" {
+		return fmt.Errorf("could not refresh token: %s, run maze login", tokens.Error)
+	}
+
+	profile.AuthToken = tokens.AccessToken
+	if tokens.TokenType != "" {
+		profile.TokenType = tokens.TokenType
+	}
+	if tokens.RefreshToken != "" {
+		profile.RefreshToken = tokens.RefreshToken
+	}
+	if err := ux.StoreProfile(profile); err != nil {
+		return err
+	}
+	token = profile.AuthHeader()
+	return nil
+}
+
+// revokeToken asks the server to revoke a token as described in RFC 7009.
+func revokeToken(profile ux.Profile, value string, hint string) error {
+	if value == "" {
+		return nil
+	}
+	resp, err := httpClient().PostForm(profile.RevokeURL, neturl.Values{
+		"token":           {value},
+		"token_type_hint": {hint},
+		"client_id":       {profile.ClientID},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoking %s returned %s", strings.ReplaceAll(hint, "_", " "), resp.Status)
+	}
+	return nil
+}
+
+func init() {
+
+	loginCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to store the tokens in")
+	loginCmd.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+	addClientFlags(loginCmd)
+	loginCmd.Flags().StringVarP(&clientID, "client-id", "", "maze-cli", "The OAuth client id of the cli")
+	loginCmd.Flags().StringVarP(&deviceURL, "device-url", "", "", "The device authorization endpoint (defaults to <url>/api/oauth/device/code)")
+	loginCmd.Flags().StringVarP(&tokenURL, "token-url", "", "", "The token endpoint (defaults to <url>/api/oauth/token)")
+	loginCmd.Flags().StringVarP(&revokeURL, "revoke-url", "", "", "The token revocation endpoint (defaults to <url>/api/oauth/revoke)")
+	loginCmd.Flags().BoolVarP(&noBrowser, "no-browser", "", false, "Print the login url without opening a browser")
+	loginCmd.SetOutput(color.Output)
+
+	logoutCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to log out of")
+	addClientFlags(logoutCmd)
+	logoutCmd.SetOutput(color.Output)
+
+}
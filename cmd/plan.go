@@ -5,7 +5,6 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -33,12 +32,17 @@ type Check struct {
 		Result        string   `json:"result"`
 		EvaluatedKeys []string `json:"evaluated_keys"`
 	} `json:"check_result"`
-	FilePath string `json:"file_path"`
-	Resource string `json:"resource"`
+	FilePath        string `json:"file_path"`
+	FileLineRange   []int  `json:"file_line_range,omitempty"`
+	Resource        string `json:"resource"`
+	SuppressComment string `json:"suppress_comment,omitempty"`
 }
 
 type Results struct {
-	FailedChecks []Check `json:"failed_checks"`
+	PassedChecks  []Check `json:"passed_checks,omitempty"`
+	FailedChecks  []Check `json:"failed_checks"`
+	SkippedChecks []Check `json:"skipped_checks,omitempty"`
+	WarningChecks []Check `json:"warning_checks,omitempty"`
 }
 
 type Summary struct {
@@ -56,6 +60,18 @@ type Response struct {
 	Summary   Summary `json:"summary"`
 }
 
+type Resources struct {
+	HourlyCost  float64 `json:"hourlyCost"`
+	Description string  `json:"description"`
+	Currency    string  `json:"currency"`
+	Resource    string  `json:"resource"`
+}
+
+type Cost struct {
+	TotalCost float64     `json:"totalCost"`
+	Resources []Resources `json:"resources"`
+}
+
 var (
 	dirPath       string
 	url           string
@@ -63,7 +79,7 @@ var (
 	generateImage bool
 	token         string
 	profileName   string
-	provider      string
+	providers     []string
 )
 
 // planCmd represents the plan command
@@ -72,52 +88,88 @@ var planCmd = &cobra.Command{
 	Short: ux.ShortTextPlan,
 	Long:  ux.LongTextPlan,
 	Run: func(cmd *cobra.Command, args []string) {
-		mazePlan()
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if recursive {
+			if projectID != "" {
+				// Every root is a project of its own.
+				fmt.Println("--project-id cannot be used with --recursive")
+				os.Exit(1)
+			}
+			if err := planRoots(cmd); err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+		err := mazePlan()
+		if summaryFile != "" {
+			writePlanSummary(err)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
 	},
 }
 
 func mazePlan() error {
+	if generateImage {
+		if err := checkImageOptions(); err != nil {
+			fmt.Println(err)
+			return err
+		}
+	}
+	projectTags, err := parseTags(tags)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
 	style := color.New()
 	style.AddRGB(5, 98, 254)
 	style.Add(color.Bold)
 	fmt.Println()
 	style.Printf(ux.MazeLogo)
 	style.Println("Terraform plan")
-	fmt.Printf("We are going to create a project in maze using terraform provided from %s and the project will be named %s\n\nUsing "+url+" as the server (to change use -u)\n\n\n", dirPath, name)
+	// Update the project given with --project-id, or the one this directory
+	// was last planned into, instead of creating a new one.
+	existingID, remembered := projectID, false
+	if existingID == "" && !newProject {
+		existingID = rememberedProject()
+		remembered = existingID != ""
+	}
+	if existingID != "" {
+		fmt.Printf("We are going to update the maze project %s named %s using terraform provided from %s\n\nUsing "+url+" as the server (to change use -u)\n\n\n", existingID, name, dirPath)
+	} else {
+		fmt.Printf("We are going to create a project in maze using terraform provided from %s and the project will be named %s\n\nUsing "+url+" as the server (to change use -u)\n\n\n", dirPath, name)
+	}
 
 	time.Sleep(2000 * time.Millisecond)
 
-	if provider != "aws" && provider != "azure" && provider != "gcp" {
-		fmt.Println("Enter the provider you are using - aws/azure/gcp (use --provider to pass in provider):")
-		fmt.Scanln(&provider)
-		if provider != "aws" && provider != "azure" && provider != "gcp" {
-			for ok := true; ok; ok = provider != "aws" && provider != "azure" && provider != "gcp" {
-				fmt.Println("Provider needs to be one provided")
-				fmt.Println("Enter the provider you are using - aws/azure/gcp:")
-				fmt.Scanln(&provider)
-			}
-		}
+	if !providerStep() {
+		return errors.New("no provider to plan")
 	}
 	success := authStep()
 
 	if !success {
-		return nil
+		return errors.New("authentication failed")
 	}
 
-	if provider == "gcp" {
-		provider = "google"
-	} else if provider == "azure" {
-		provider = "azurerm"
-	}
 	time.Sleep(500 * time.Millisecond)
 
-	body, writer := readFileStep()
+	collection, success := readFileStep()
+	if !success {
+		return errors.New("reading the terraform files failed")
+	}
 
 	time.Sleep(1000 * time.Millisecond)
-	success, path := sendFiles(body, writer)
-	folderPath := filepath.Join(dirPath, "maze-output")
+	success, path := uploadStep(collection)
+	if !success {
+		return errors.New("uploading the terraform files failed")
+	}
+	folderPath := outputPath()
 	if _, err := os.Stat(folderPath); errors.Is(err, os.ErrNotExist) {
-		err := os.Mkdir(folderPath, os.ModePerm)
+		err := os.MkdirAll(folderPath, os.ModePerm)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -131,24 +183,40 @@ func mazePlan() error {
 
 	time.Sleep(1000 * time.Millisecond)
 
-	complianceStep(string(path))
+	complianceData := complianceStep(string(path))
+	if policyDir != "" {
+		if success, complianceData = policyStep(complianceData, collection); !success {
+			return errors.New("policy evaluation failed")
+		}
+	}
+	planResult.PassedChecks = complianceData.Summary.Passed
+	planResult.FailedChecks = complianceData.Summary.Failed
 
 	time.Sleep(1000 * time.Millisecond)
 
-	success, projectIdBytes := planStep(string(path))
+	success, projectIdBytes := planStep(string(path), projectTags, existingID, remembered)
 	projectId := string(projectIdBytes)
 
 	if !success {
-		return nil
+		return errors.New("creating the maze project failed")
+	}
+	if existingID != "" && projectId != existingID {
+		fmt.Printf("Project %s could not be updated, created project %s instead\n", existingID, projectId)
+	}
+	if err := rememberProject(projectId); err != nil {
+		fmt.Println("Could not remember the project:", err)
 	}
 
 	time.Sleep(1000 * time.Millisecond)
 
-	costStep(projectId)
+	costCalculated, cost := costStep(projectId)
+	planResult.ProjectID = projectId
+	planResult.CostCalculated = costCalculated
+	planResult.MonthlyCost = cost.TotalCost * 730
 
 	time.Sleep(1000 * time.Millisecond)
 	if generateImage {
-		imageStep(projectId, dirPath)
+		imageStep(projectId)
 		time.Sleep(2000 * time.Millisecond)
 	}
 
@@ -161,12 +229,23 @@ func mazePlan() error {
 
 	style.Println("----------------------------------------------------------------------")
 
-	fmt.Println(url + "/projects/" + projectId + "/canvas")
+	planResult.CanvasURL = url + "/projects/" + projectId + "/canvas"
+	fmt.Println(planResult.CanvasURL)
 	style.Println("----------------------------------------------------------------------")
 
 	fmt.Println("")
 
-	return nil
+	printProviderBreakdown(complianceData, cost, costCalculated)
+
+	run := newHistoryEntry("plan")
+	run.ProjectID = projectId
+	run.addCompliance(complianceData)
+	if costCalculated {
+		run.addCost(cost)
+	}
+	recordRun(run)
+
+	return checkThresholds(complianceData, cost, costCalculated)
 }
 
 func authStep() (success bool) {
@@ -190,17 +269,23 @@ func authStep() (success bool) {
 	authStartSpinner.Start()
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(authReq)
+	resp, err := doAuthorized(httpClient(), authReq)
 	if err != nil {
 		authStartSpinner.Fail()
+		fmt.Println(err)
 		return false
 
 	}
+	defer resp.Body.Close()
 	// Check the response status.
 	if resp.StatusCode != http.StatusOK {
 		authStartSpinner.Fail()
-		fmt.Println("Check your authentication token or selected profile and try again")
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			fmt.Println("Check your authentication token or selected profile and try again")
+		} else {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			fmt.Println(responseError(resp, bodyBytes))
+		}
 		return false
 
 	}
@@ -208,122 +293,253 @@ func authStep() (success bool) {
 	return true
 }
 
-func readFileStep() (body bytes.Buffer, writer *multipart.Writer) {
+func readFileStep() (collection fileCollection, success bool) {
+	if iacMode != "auto" && iacMode != "terraform" && iacMode != "opentofu" && iacMode != "terragrunt" {
+		fmt.Println("IaC needs to be one of auto, terraform, opentofu or terragrunt")
+		return
+	}
 
-	writer = multipart.NewWriter(&body)
-	// Get the boundary string from the writer to use in the Content-Type header.
+	collection, err := collectFiles()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(collection.initModules) > 0 {
+		fmt.Println("Using modules installed by terraform init:")
+		for _, module := range collection.initModules {
+			fmt.Println(" -", module.Key, "("+strings.TrimSpace(module.Source+" "+module.Version)+")")
+		}
+	}
+	if len(collection.moduleDirs) > 0 {
+		fmt.Println("Including local modules from outside", dirPath+":")
+		for _, moduleDir := range collection.moduleDirs {
+			if relativeDir, err := filepath.Rel(dirPath, moduleDir); err == nil {
+				moduleDir = relativeDir
+			}
+			fmt.Println(" -", moduleDir)
+		}
+	}
+	if len(collection.units) > 0 {
+		fmt.Println("Found terragrunt units, in the order they apply:")
+		unitDirs := map[string]bool{}
+		for _, unit := range collection.units {
+			unitDirs[unit.dir] = true
+		}
+		root, _ := filepath.Abs(dirPath)
+		relative := func(dir string) string {
+			if relativeDir, err := filepath.Rel(root, dir); err == nil {
+				return relativeDir
+			}
+			return dir
+		}
+		for _, unit := range collection.units {
+			line := " - " + relative(unit.dir)
+			if unit.source != "" {
+				line += " (" + unit.source + ")"
+			}
+			fmt.Println(line)
+			var after, missing []string
+			for _, dependency := range unit.dependencies {
+				if unitDirs[dependency] {
+					after = append(after, relative(dependency))
+				} else {
+					missing = append(missing, relative(dependency))
+				}
+			}
+			if len(after) > 0 {
+				fmt.Println("   after:", strings.Join(after, ", "))
+			}
+			if len(missing) > 0 {
+				fmt.Println("   depends on units outside of --dir that are not uploaded:", strings.Join(missing, ", "))
+			}
+			if len(unit.skippedInputs) > 0 {
+				fmt.Println("   inputs left out, they are only known after apply:", strings.Join(uniqueSorted(unit.skippedInputs), ", "))
+			}
+		}
+	}
 
-	// Walk through the directory and add all files to the multipart form.
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if len(collection.varFiles) > 0 {
+		fmt.Println("Using variables files:")
+		for _, varFile := range collection.varFiles {
+			fmt.Println(" -", varFile)
 		}
+	}
+	if collection.overrides {
+		fmt.Println("Variable values from --var-file, --var and TF_VAR_ written to", overridesName)
+	}
+	if len(collection.environmentVariables) > 0 {
+		fmt.Println("Using values from the environment (leave them out with --no-env-vars):", strings.Join(collection.environmentVariables, ", "))
+	}
 
-		// Skip the "maze-output" directory.
-		if info.IsDir() && info.Name() == "maze-output" {
-			return filepath.SkipDir
+	redactions, err := redactStep(&collection)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(redactions) > 0 {
+		fmt.Println("Redacted sensitive values before upload:")
+		for _, redaction := range redactions {
+			fmt.Printf(" - %s: %s\n", redaction.relativePath, strings.Join(redaction.values, ", "))
 		}
+	}
 
-		// Skip directories; only process files.
-		if !info.IsDir() {
-			// Open the file.
-			if strings.HasPrefix(filepath.Ext(info.Name()), ".tf") || strings.HasPrefix(filepath.Ext(info.Name()), ".tfvars") || strings.HasPrefix(filepath.Ext(info.Name()), ".tfstate") {
+	findings, err := scanSecrets(collection)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(findings) > 0 {
+		fmt.Println("Possible credentials found:")
+		for _, finding := range findings {
+			fmt.Printf(" - %s:%d %s\n", finding.relativePath, finding.line, finding.rule)
+		}
+		if !allowSecrets {
+			fmt.Println("Nothing was uploaded. Remove the credentials, add the files to .mazeignore or use --allow-secrets")
+			return
+		}
+	}
 
-				fileToUpload, err := os.Open(path)
-				if err != nil {
-					return fmt.Errorf("failed to open file %s: %v", path, err)
-				}
-				defer fileToUpload.Close()
+	if err := checkUploadSize(collection); err != nil {
+		fmt.Println(err)
+		return
+	}
+	return collection, true
+}
 
-				// Create a form file field for the file with the key "file".
-				part, err := writer.CreateFormFile("file", info.Name())
-				if err != nil {
-					return fmt.Errorf("failed to create form file: %v", err)
-				}
+// uploadStep sends the collected files to the server, as an archive when the
+// server supports it and as the legacy multipart form otherwise.
+func uploadStep(collection fileCollection) (success bool, path []byte) {
+	if uploadMode != "auto" && uploadMode != "archive" && uploadMode != "legacy" {
+		fmt.Println("Upload mode needs to be one of auto, archive or legacy")
+		return
+	}
+	if uploadMode == "auto" && !archiveSupported() {
+		fmt.Println(ux.PrintBlue("ℹ"), archiveFallbackNotice)
+	} else if uploadMode != "legacy" {
+		success, path, supported := sendArchive(collection)
+		if supported || uploadMode == "archive" {
+			return success, path
+		}
+	}
+	return sendFiles(collection)
+}
 
-				// Copy the file content to the multipart form field.
-				if _, err := io.Copy(part, fileToUpload); err != nil {
-					return fmt.Errorf("failed to copy file content: %v", err)
-				}
+// writeLegacyForm writes the multipart form of older servers, holding every
+// file followed by its relative path.
+func writeLegacyForm(writer *multipart.Writer, collection fileCollection, progress *ux.Progress) error {
+	// Add all collected files to the multipart form.
+	for _, file := range collection.files {
+		if err := addFormFile(writer, file, progress); err != nil {
+			return err
+		}
+	}
 
-				// Compute the relative path of the file to the base directory.
-				relativePath, err := filepath.Rel(dirPath, path)
-				if err != nil {
-					return fmt.Errorf("failed to compute relative path: %v", err)
-				}
+	// Tell the server where --dir sits when modules widened the upload.
+	if collection.rootPath != "." {
+		if err := writer.WriteField("rootPath", filepath.ToSlash(collection.rootPath)); err != nil {
+			return fmt.Errorf("failed to write path field: %v", err)
+		}
+	}
 
-				// Create a form field for the file path using the relative path.
-				if err := writer.WriteField("originalPath", relativePath); err != nil {
-					return fmt.Errorf("failed to write path field: %v", err)
-				}
-			}
+	if err := writer.WriteField("iac", collection.iac); err != nil {
+		return fmt.Errorf("failed to write iac field: %v", err)
+	}
+	for _, varFile := range collection.varFiles {
+		if err := writer.WriteField("varFile", filepath.ToSlash(varFile)); err != nil {
+			return fmt.Errorf("failed to write path field: %v", err)
 		}
-		return nil
-	})
-	if err != nil {
-		return
 	}
 
-	// Close the multipart writer to finalize the form data.
-	if err := writer.Close(); err != nil {
-		return
+	// Point the server at the resolved plan.
+	if collection.planPath != "" {
+		if err := writer.WriteField("planPath", filepath.ToSlash(collection.planPath)); err != nil {
+			return fmt.Errorf("failed to write path field: %v", err)
+		}
 	}
-	return
+	return nil
 }
 
-func sendFiles(body bytes.Buffer, writer *multipart.Writer) (success bool, bodyBytes []byte) {
-	success = false
+// addFormFile copies a collected file into the multipart form, followed by
+// its relative path.
+func addFormFile(writer *multipart.Writer, file collectedFile, progress *ux.Progress) error {
+	// Open the file.
+	fileToUpload, err := file.open()
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", file.path, err)
+	}
+	defer fileToUpload.Close()
 
-	boundary := writer.Boundary()
+	// Create a form file field for the file with the key "file".
+	part, err := writer.CreateFormFile("file", filepath.Base(file.path))
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %v", err)
+	}
 
-	// Create a new HTTP request with the multipart data.
+	// Copy the file content to the multipart form field.
+	if _, err := io.Copy(part, progress.Reader(fileToUpload)); err != nil {
+		return fmt.Errorf("failed to copy file content: %v", err)
+	}
+
+	// Create a form field for the file path using the relative path.
+	if err := writer.WriteField("originalPath", file.relativePath); err != nil {
+		return fmt.Errorf("failed to write path field: %v", err)
+	}
+	return nil
+}
+
+func sendFiles(collection fileCollection) (success bool, bodyBytes []byte) {
+	success = false
 
-	submitReq, err := http.NewRequest("POST", url+"/api/cli/submitFiles/", &body)
+	progress := ux.NewProgress("Uploading files", collection.size())
 
+	// Create a new HTTP request streaming the multipart data.
+	submitReq, err := newStreamingRequest(url+"/api/cli/submitFiles/", func(writer *multipart.Writer) error {
+		progress.Reset()
+		return writeLegacyForm(writer, collection, progress)
+	})
 	if err != nil {
 		return
 	}
 
-	submitReq.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=%s", boundary))
-
 	// Set the Authorization header with the provided token.
 	submitReq.Header.Set("Authorization", token)
-	var uploadStartSpinner = ux.NewSpinner("Uploading files", "Files uploaded", "Upload failed", false)
-	uploadStartSpinner.Start()
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(submitReq)
+	resp, err := doAuthorized(httpClient(), submitReq)
 	if err != nil {
+		progress.Fail("Upload failed")
+		fmt.Println(err)
 		return
 	}
+	defer resp.Body.Close()
 	bodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
+		progress.Fail("Upload failed")
 		fmt.Println(err)
 		return
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
 		success = true
 	} else {
-		uploadStartSpinner.Fail()
-		fmt.Println(resp)
+		progress.Fail("Upload failed")
+		fmt.Println(responseError(resp, bodyBytes))
 		return
 
 	}
-	uploadStartSpinner.Success()
+	progress.Success("Files uploaded")
 	return
 }
 
-func complianceStep(path string) {
+func complianceStep(path string) (data Response) {
 
 	//Compliance  ----------------------------------------------
-	var complianceStartSpinner = ux.NewSpinner("Starting compliance testing", "Compliance testing complete", "Authentication failed", false)
+	var complianceStartSpinner = ux.NewSpinner("Starting compliance testing", "Compliance testing complete", "Compliance testing failed", false)
 	complianceStartSpinner.Start()
 	submitReq, err := http.NewRequest("GET", url+"/api/cli/compliance/"+path, nil)
 
 	// Create a new HTTP request with the multipart data.
 	if err != nil {
+		complianceStartSpinner.Fail()
 		return
 	}
 
@@ -334,12 +550,13 @@ func complianceStep(path string) {
 	submitReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(submitReq)
+	resp, err := doAuthorized(httpClient(), submitReq)
 	if err != nil {
 		complianceStartSpinner.Fail()
+		fmt.Println(err)
 		return
 	}
+	defer resp.Body.Close()
 	bodyBytes, err := io.ReadAll(resp.Body)
 
 	if err != nil {
@@ -347,8 +564,12 @@ func complianceStep(path string) {
 		fmt.Println(err)
 		return
 	}
+	if resp.StatusCode != http.StatusOK {
+		complianceStartSpinner.Fail()
+		fmt.Println(responseError(resp, bodyBytes))
+		return
+	}
 
-	var data Response
 	if err := json.Unmarshal(bodyBytes, &data); err != nil {
 		fmt.Printf("Compliance testing failed: %v", err)
 	}
@@ -359,7 +580,7 @@ func complianceStep(path string) {
 	fmt.Printf("    Passed: %d\n", data.Summary.Passed)
 	fmt.Printf("    Failed: %d\n", data.Summary.Failed)
 
-	filePath := filepath.Join(dirPath, "maze-output", "maze_compliance_results.json")
+	filePath := outputPath("maze_compliance_results.json")
 	if err := os.WriteFile(filePath, bodyBytes, 0644); err != nil {
 		fmt.Printf("Failed to write response to file: %v", err)
 	}
@@ -374,7 +595,11 @@ func validateStep(path string) (success bool) {
 
 	var validateStartSpinner = ux.NewSpinner("Validation starting", "Validation complete", "Validation failed", false)
 	validateStartSpinner.Start()
-	body := []byte(`{"provider":"` + provider + `"}`)
+	body, err := json.Marshal(providerPayload())
+	if err != nil {
+		validateStartSpinner.Fail()
+		return false
+	}
 
 	validateReq, err := http.NewRequest("GET", url+"/api/cli/tfvalidate/"+path, bytes.NewBuffer(body))
 	if err != nil {
@@ -387,20 +612,24 @@ func validateStep(path string) (success bool) {
 	validateReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(validateReq)
+	resp, err := doAuthorized(httpClient(), validateReq)
+	if err != nil {
+		validateStartSpinner.Fail()
+		fmt.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		validateStartSpinner.Fail()
-
+		fmt.Println(err)
 		return false
 
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		validateStartSpinner.Fail()
 
-		fmt.Println("validate service unavailable")
+		fmt.Println("Validate service unavailable:", responseError(resp, bodyBytes))
 		return false
 
 	}
@@ -429,21 +658,24 @@ func formatStep(path string) (success bool) {
 	time.Sleep(1000 * time.Millisecond)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(formatReq)
+	resp, err := doAuthorized(httpClient(), formatReq)
 	if err != nil {
 		formatStartSpinner.Fail()
-
+		fmt.Println(err)
 		return false
 
 	}
-	//bodyBytes, err := io.ReadAll(resp.Body)
-
-	//defer resp.Body.Close()
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		formatStartSpinner.Fail()
+		fmt.Println(err)
+		return false
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		formatStartSpinner.Fail()
 
-		fmt.Println("Format service unavailable")
+		fmt.Println("Format service unavailable:", responseError(resp, bodyBytes))
 		return false
 
 	}
@@ -454,10 +686,27 @@ func formatStep(path string) (success bool) {
 
 }
 
-func planStep(path string) (success bool, bodyBytes []byte) {
+// planStep creates a project from the uploaded files, or updates existingID.
+// A remembered project that no longer exists is created again.
+func planStep(path string, projectTags map[string]string, existingID string, remembered bool) (success bool, bodyBytes []byte) {
 
 	success = false
-	body := []byte(`{"name":"test","description":"test","provider":"` + provider + `"}`)
+	payload := providerPayload()
+	payload["name"] = name
+	// Updates keep the description and tags they are not given.
+	if description != "" || existingID == "" {
+		payload["description"] = description
+	}
+	if len(projectTags) > 0 || existingID == "" {
+		payload["tags"] = projectTags
+	}
+	if existingID != "" {
+		payload["projectId"] = existingID
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
 	var planStartSpinner = ux.NewSpinner("Plan starting", "Plan started", "Plan failed to start", false)
 	planStartSpinner.Start()
 	time.Sleep(1000 * time.Millisecond)
@@ -470,6 +719,7 @@ func planStep(path string) (success bool, bodyBytes []byte) {
 
 	// Create a new HTTP request with the multipart data.
 	if err != nil {
+		planProgressSpinner.Fail()
 		return
 	}
 
@@ -480,26 +730,31 @@ func planStep(path string) (success bool, bodyBytes []byte) {
 	submitReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(submitReq)
+	resp, err := doAuthorized(httpClient(), submitReq)
 	if err != nil {
 		planProgressSpinner.Fail()
+		fmt.Println(err)
 		return
 	}
+	defer resp.Body.Close()
 	bodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
 		planProgressSpinner.Fail()
 		fmt.Println(err)
 		return
 	}
-	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound && remembered {
+		planProgressSpinner.Fail("Project " + existingID + " no longer exists")
+		return planStep(path, projectTags, "", false)
+	}
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
 		planProgressSpinner.Success()
 		success = true
 	} else {
-		fmt.Println(resp)
-		return
+		planProgressSpinner.Fail()
+		fmt.Println(responseError(resp, bodyBytes))
+		return false, nil
 
 	}
 	// var planProcessingSpinner = ux.NewSpinner("Plan processing", "Plan processed", "Plan failed", false)
@@ -520,13 +775,13 @@ func deleteFilesStep(path string) (success bool) {
 	authReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(authReq)
+	resp, err := doAuthorized(httpClient(), authReq)
 
 	if err != nil {
 		return false
 
 	}
+	resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return false
 
@@ -534,7 +789,7 @@ func deleteFilesStep(path string) (success bool) {
 	return true
 }
 
-func costStep(projectId string) (success bool) {
+func costStep(projectId string) (success bool, cost Cost) {
 	//Cost ----------------------------------------------
 
 	var costStartSpinner = ux.NewSpinner("Calculating cloud cost", "Cost calculated", "Cost calculation failed", false)
@@ -542,99 +797,110 @@ func costStep(projectId string) (success bool) {
 
 	authReq, err := http.NewRequest("GET", url+"/api/cost/"+projectId, nil)
 	if err != nil {
-		return false
+		costStartSpinner.Fail()
+		return false, cost
 	}
 
 	//Auth ----------------------------------------------
 	authReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(authReq)
+	resp, err := doAuthorized(httpClient(), authReq)
+	if err != nil {
+		costStartSpinner.Fail()
+		fmt.Println(err)
+		return false, cost
+	}
+	defer resp.Body.Close()
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		costStartSpinner.Fail()
-		return false
+		fmt.Println(err)
+		return false, cost
 
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		costStartSpinner.Fail()
-		fmt.Println("cost service unavailable")
-		return false
+		fmt.Println("Cost service unavailable:", responseError(resp, bodyBytes))
+		return false, cost
 
 	}
-	type Resources struct {
-		HourlyCost  float64 `json:"hourlyCost"`
-		Description string  `json:"description"`
-		Currency    string  `json:"currency"`
-		Resource    string  `json:"resource"`
-	}
-	type Cost struct {
-		TotalCost float64     `json:"totalCost"`
-		Resources []Resources `json:"resources"`
-	}
-	var cost Cost
 	err = json.Unmarshal(bodyBytes, &cost)
 	if err != nil {
+		costStartSpinner.Fail()
 		fmt.Println("Error:", err)
-		return false
+		return false, cost
 	}
 	time.Sleep(2000 * time.Millisecond)
 
 	costStartSpinner.Success()
 	time.Sleep(1000 * time.Millisecond)
 
-	fmt.Println(fmt.Sprint("    Daily cost: $", roundFloat(cost.TotalCost*24, 2)))
-	fmt.Println(fmt.Sprint("    Monthly cost: $", roundFloat(cost.TotalCost*730, 2)))
+	printCost(cost)
 	// Check the response status.
 
 	time.Sleep(1000 * time.Millisecond)
 
-	return true
+	return true, cost
 }
 
-func imageStep(projectId string, path string) {
+func imageStep(projectId string) (success bool) {
 
-	filePath := filepath.Join(path, "maze-output", "maze_canvas_image.png")
+	filePath := imagePath()
 
 	var imageStartSpinner = ux.NewSpinner("Generating canvas image", "Image saved to: "+filePath, "Generating canvas image failed", false)
 	imageStartSpinner.Start()
 
-	authReq, err := http.NewRequest("GET", url+"/api/cli/canvasimage/"+projectId, nil)
+	authReq, err := http.NewRequest("GET", url+"/api/cli/canvasimage/"+projectId+"?"+imageQuery(), nil)
 	if err != nil {
-		return
+		imageStartSpinner.Fail()
+		return false
 	}
 
 	//Auth ----------------------------------------------
 	authReq.Header.Set("Authorization", token)
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(authReq)
+	resp, err := doAuthorized(httpClient(), authReq)
+	if err != nil {
+		imageStartSpinner.Fail()
+		fmt.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
 	imageData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		imageStartSpinner.Fail()
-		return
-
+		fmt.Println(err)
+		return false
+	}
+	if resp.StatusCode != http.StatusOK {
+		imageStartSpinner.Fail()
+		fmt.Println("The canvas image could not be generated:", responseError(resp, imageData))
+		return false
 	}
 
-	imgBytes, err := base64.StdEncoding.DecodeString(string(imageData))
+	imgBytes, err := decodeImage(imageData, imageFormat)
 	if err != nil {
+		imageStartSpinner.Fail()
 		fmt.Println(err)
+		return false
+	}
 
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
 		imageStartSpinner.Fail()
-		return
+		fmt.Println(err)
+		return false
 	}
-
 	err = os.WriteFile(filePath, imgBytes, 0644)
 	if err != nil {
 		fmt.Println(err)
 		imageStartSpinner.Fail()
 
-		return
+		return false
 	}
 	imageStartSpinner.Success()
+	return true
 }
 
 func roundFloat(val float64, precision uint) float64 {
@@ -647,9 +913,44 @@ func init() {
 	planCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
 	planCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to get the auth token from")
 	planCmd.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+	addClientFlags(planCmd)
 	planCmd.Flags().StringVarP(&name, "name", "n", "default", "The name for the generated project")
-	planCmd.Flags().StringVarP(&provider, "provider", "", "", "The name of the provider, e.g. AWS or AZURE")
+	planCmd.Flags().StringVarP(&description, "description", "", "", "The description for the generated project")
+	planCmd.Flags().StringArrayVarP(&tags, "tag", "", nil, "Tag the project with key=value, can be repeated")
+	planCmd.Flags().StringVarP(&projectID, "project-id", "", "", "Update this maze project instead of creating one")
+	planCmd.Flags().BoolVarP(&newProject, "new-project", "", false, "Create a new project even if this directory was planned before")
+	planCmd.Flags().StringSliceVarP(&providers, "provider", "", nil, "The providers in use, e.g. aws,cloudflare (detected when not given)")
 	planCmd.Flags().BoolVarP(&generateImage, "image", "i", false, "Generate an image of the canvas and save to terraform files folder after plan is complete")
+	planCmd.Flags().StringVarP(&imageFormat, "image-format", "", "png", "The format of the canvas image: png, svg or pdf")
+	planCmd.Flags().IntVarP(&imageWidth, "image-width", "", 0, "The width of the canvas image in pixels (0 lets the server choose)")
+	planCmd.Flags().StringVarP(&imageTheme, "theme", "", "light", "The theme of the canvas image: light or dark")
+	planCmd.Flags().StringVarP(&imageOut, "image-out", "", "", "Where to save the canvas image instead of the output folder")
+	planCmd.Flags().StringSliceVarP(&includeGlobs, "include", "", nil, "Only upload files matching these gitignore style patterns")
+	planCmd.Flags().StringSliceVarP(&excludeGlobs, "exclude", "", nil, "Never upload files matching these gitignore style patterns")
+	planCmd.Flags().BoolVarP(&useGitignore, "gitignore", "", false, "Also skip files ignored by .gitignore files")
+	planCmd.Flags().BoolVarP(&useInitModules, "init-modules", "", true, "Upload the remote modules terraform init installed in .terraform/modules")
+	addUploadFlags(planCmd)
+	planCmd.Flags().StringVarP(&planJSONPath, "plan-json", "", "", "A plan rendered by terraform show -json to send to maze")
+	planCmd.Flags().StringVarP(&planFilePath, "plan-file", "", "", "A saved plan from terraform plan -out, rendered locally with terraform show -json")
+	planCmd.Flags().VarP(variableFlag{"var-file"}, "var-file", "", "Use this variables file, relative to --dir; other non-auto tfvars files are not uploaded")
+	planCmd.Flags().VarP(variableFlag{"var"}, "var", "", "Set a variable as name=value, like terraform -var")
+	planCmd.Flags().BoolVarP(&skipEnvVars, "no-env-vars", "", false, "Ignore TF_VAR_ environment variables")
+	planCmd.Flags().BoolVarP(&planOnly, "plan-only", "", false, "Send only the plan given with --plan-json or --plan-file, without the terraform files")
+	planCmd.Flags().StringVarP(&terraformBin, "terraform-bin", "", "", "The binary used to render --plan-file, tofu for OpenTofu code and terraform otherwise")
+	planCmd.Flags().StringVarP(&iacMode, "iac", "", "auto", "The kind of code in --dir: terraform, opentofu, terragrunt, or auto to detect it")
+	planCmd.MarkFlagsMutuallyExclusive("plan-json", "plan-file")
+	planCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Plan every root module below --dir and print a combined report")
+	planCmd.Flags().IntVarP(&parallelRoots, "parallel", "", 4, "How many root modules --recursive plans at once")
+	planCmd.Flags().StringVarP(&summaryFile, "summary-file", "", "", "Write a JSON summary of the run to this file")
+	planCmd.Flags().MarkHidden("summary-file")
+	planCmd.Flags().StringVarP(&outputDir, "output-dir", "", "maze-output", "The folder for results, relative to the terraform directory")
+	planCmd.Flags().Float64VarP(&maxMonthlyCost, "max-monthly-cost", "", 0, "Fail when the monthly cost is above this amount (0 disables the check)")
+	planCmd.Flags().IntVarP(&maxFailedChecks, "max-failed-checks", "", -1, "Fail when more compliance checks fail than this (-1 disables the check)")
+	planCmd.Flags().StringVarP(&policyDir, "policy-dir", "", "", "Also evaluate the Rego policies in this directory")
+	planCmd.Flags().BoolVarP(&skipHistory, "no-history", "", false, "Do not record the run in .maze/history.jsonl")
+
+	// config show resolves the same flags as plan.
+	configShowCmd.Flags().AddFlagSet(planCmd.Flags())
 
 	planCmd.SetOutput(color.Output)
 	cobra.AddTemplateFunc("StyleHeading", color.RGB(5, 98, 254).SprintFunc())
@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// Name the resolved plan is uploaded as, next to the root module's files.
+const planUploadName = "maze-plan.json"
+
+var (
+	planJSONPath string
+	planFilePath string
+	planOnly     bool
+	terraformBin string
+)
+
+// loadPlan reads the plan given with --plan-json, or renders the saved plan
+// given with --plan-file through terraform show -json.
+func loadPlan(iac string) (file collectedFile, err error) {
+	var data []byte
+	if planJSONPath != "" {
+		file.path = planJSONPath
+		if data, err = os.ReadFile(planJSONPath); err != nil {
+			return file, fmt.Errorf("failed to read plan %s: %v", planJSONPath, err)
+		}
+	} else {
+		file.path = planFilePath
+		if data, err = showPlan(planFilePath, iac); err != nil {
+			return file, err
+		}
+	}
+
+	var plan struct {
+		FormatVersion   string          `json:"format_version"`
+		PlannedValues   json.RawMessage `json:"planned_values"`
+		ResourceChanges json.RawMessage `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(data, &plan); err != nil || plan.FormatVersion == "" || (plan.PlannedValues == nil && plan.ResourceChanges == nil) {
+		return file, fmt.Errorf("%s is not the output of terraform show -json", file.path)
+	}
+
+	file.content = data
+	file.size = int64(len(data))
+	return file, nil
+}
+
+// showPlan runs terraform show -json on a saved plan from the terraform
+// directory, so the plan is read with the providers terraform init installed.
+// OpenTofu plans are read with tofu unless --terraform-bin says otherwise.
+func showPlan(path string, iac string) ([]byte, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	bin := terraformBin
+	if bin == "" && iac == "opentofu" {
+		bin = "tofu"
+	} else if bin == "" {
+		bin = "terraform"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, "show", "-json", path)
+	cmd.Dir = dirPath
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%s was not found, install it or use --terraform-bin", bin)
+		}
+		return nil, fmt.Errorf("%s show -json %s failed: %v\n%s", bin, path, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// redactPlan masks the values terraform marked sensitive in the plan, the
+// values of sensitive variables and anything whose key matches a redact key.
+func redactPlan(file collectedFile, keyPatterns []*regexp.Regexp, sensitiveVariables map[string]bool) (collectedFile, []string, error) {
+	var plan map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(file.content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&plan); err != nil {
+		return file, nil, fmt.Errorf("could not parse plan %s: %v", file.path, err)
+	}
+
+	// The plan's own configuration says which variables are sensitive, which
+	// matters when the terraform files are not uploaded with it.
+	declared := valuesOf(valuesOf(valuesOf(plan["configuration"])["root_module"])["variables"])
+
+	var values []string
+	if variables, ok := plan["variables"].(map[string]interface{}); ok {
+		for variableName, variable := range variables {
+			variable, ok := variable.(map[string]interface{})
+			sensitive, _ := valuesOf(declared[variableName])["sensitive"].(bool)
+			if ok && (sensitive || sensitiveVariables[variableName] || matchesKey(keyPatterns, variableName)) {
+				variable["value"] = redactedValue
+				values = append(values, "var."+variableName)
+			}
+		}
+	}
+
+	// Resource changes carry their sensitive markings next to the values.
+	changes, _ := plan["resource_changes"].([]interface{})
+	for _, change := range changes {
+		change, ok := change.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		detail, ok := change["change"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address := fmt.Sprint(change["address"])
+		for _, side := range []string{"before", "after"} {
+			for _, name := range maskSensitive(detail[side], detail[side+"_sensitive"], "") {
+				values = append(values, address+"."+name)
+			}
+			for _, name := range redactMatchingKeys(detail[side], keyPatterns, "") {
+				values = append(values, address+"."+name)
+			}
+		}
+	}
+
+	// Planned values and prior state list resources per module.
+	values = append(values, redactPlanModule(valuesOf(plan["planned_values"])["root_module"], keyPatterns)...)
+	values = append(values, redactPlanModule(valuesOf(valuesOf(plan["prior_state"])["values"])["root_module"], keyPatterns)...)
+	if outputs, ok := valuesOf(plan["planned_values"])["outputs"].(map[string]interface{}); ok {
+		for outputName, output := range outputs {
+			output, ok := output.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if sensitive, _ := output["sensitive"].(bool); sensitive || matchesKey(keyPatterns, outputName) {
+				output["value"] = redactedValue
+				values = append(values, "output."+outputName)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return file, nil, nil
+	}
+	content, err := json.Marshal(plan)
+	if err != nil {
+		return file, nil, fmt.Errorf("failed to write redacted plan %s: %v", file.path, err)
+	}
+	file.content = content
+	file.size = int64(len(content))
+	return file, uniqueSorted(values), nil
+}
+
+// redactPlanModule masks sensitive values of the resources in a plan module
+// and its child modules.
+func redactPlanModule(module interface{}, keyPatterns []*regexp.Regexp) (values []string) {
+	moduleValues := valuesOf(module)
+	resources, _ := moduleValues["resources"].([]interface{})
+	for _, resource := range resources {
+		resource := valuesOf(resource)
+		address := fmt.Sprint(resource["address"])
+		for _, name := range maskSensitive(resource["values"], resource["sensitive_values"], "") {
+			values = append(values, address+"."+name)
+		}
+		for _, name := range redactMatchingKeys(resource["values"], keyPatterns, "") {
+			values = append(values, address+"."+name)
+		}
+	}
+	childModules, _ := moduleValues["child_modules"].([]interface{})
+	for _, child := range childModules {
+		values = append(values, redactPlanModule(child, keyPatterns)...)
+	}
+	return values
+}
+
+// maskSensitive masks the parts of value that the mirrored mask structure
+// marks with true.
+func maskSensitive(value interface{}, mask interface{}, prefix string) (names []string) {
+	switch mask := mask.(type) {
+	case map[string]interface{}:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, nestedMask := range mask {
+			if sensitive, _ := nestedMask.(bool); sensitive {
+				if _, exists := object[key]; exists {
+					object[key] = redactedValue
+					names = append(names, prefix+key)
+				}
+				continue
+			}
+			names = append(names, maskSensitive(object[key], nestedMask, prefix+key+".")...)
+		}
+	case []interface{}:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, nestedMask := range mask {
+			if i >= len(list) {
+				break
+			}
+			if sensitive, _ := nestedMask.(bool); sensitive {
+				list[i] = redactedValue
+				names = append(names, fmt.Sprintf("%s%d", prefix, i))
+				continue
+			}
+			names = append(names, maskSensitive(list[i], nestedMask, fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	return names
+}
+
+// valuesOf returns value as a JSON object, or an empty one.
+func valuesOf(value interface{}) map[string]interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return object
+}
@@ -0,0 +1,319 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"maze/cmd/ux"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+var policyDir string
+
+// Rules of a policy package whose messages fail the run, and those whose
+// messages are only reported.
+var (
+	denyRules = []string{"deny", "violation"}
+	warnRules = []string{"warn"}
+)
+
+// A deny or warn message from a policy.
+type policyMessage struct {
+	// Custom ID, or the package the message came from such as terraform.s3.
+	id      string
+	message string
+	// Resource address given by the policy or found in the message.
+	resource string
+}
+
+// policyStep evaluates the Rego policies in --policy-dir against the
+// terraform, or the plan when one was given, and adds their deny messages to
+// the compliance results as failed checks and their warn messages as
+// warnings. The results file is saved again with them.
+func policyStep(data Response, collection fileCollection) (success bool, merged Response) {
+	var policyStartSpinner = ux.NewSpinner("Evaluating policies from "+policyDir, "Policies evaluated", "Policy evaluation failed", false)
+	policyStartSpinner.Start()
+
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		policyStartSpinner.Fail()
+		fmt.Println(err)
+		return false, data
+	}
+	resources, _ := readLocalResources(collection, root)
+	input, err := policyInput(collection, resources)
+	if err != nil {
+		policyStartSpinner.Fail()
+		fmt.Println(err)
+		return false, data
+	}
+	denied, warned, err := evaluatePolicies(policyDir, input)
+	if err != nil {
+		policyStartSpinner.Fail()
+		fmt.Println(err)
+		return false, data
+	}
+	policyStartSpinner.Success(fmt.Sprintf("Policies evaluated: %d denied, %d warnings", len(denied), len(warned)))
+
+	// Root module resources come first and win when a module has a resource
+	// with the same type and name.
+	byAddress := map[string]localResource{}
+	for _, resource := range resources {
+		if _, exists := byAddress[resource.typeName+"."+resource.name]; !exists {
+			byAddress[resource.typeName+"."+resource.name] = resource
+		}
+	}
+	toCheck := func(message policyMessage, result string) Check {
+		check := Check{CheckID: message.id, CheckName: message.message, Resource: message.resource}
+		if resource, exists := byAddress[resourceTypeAndName(message.resource)]; exists {
+			check = resource.check(message.id, message.message)
+			check.Resource = message.resource
+		}
+		check.CheckResult.Result = result
+		return check
+	}
+
+	var policyChecks []Check
+	for _, message := range denied {
+		check := toCheck(message, "FAILED")
+		data.Results.FailedChecks = append(data.Results.FailedChecks, check)
+		data.Summary.Failed++
+		policyChecks = append(policyChecks, check)
+	}
+	for _, message := range warned {
+		check := toCheck(message, "WARNING")
+		data.Results.WarningChecks = append(data.Results.WarningChecks, check)
+		policyChecks = append(policyChecks, check)
+	}
+	printChecks(policyChecks)
+	if len(denied) > 0 {
+		fmt.Printf("    Failed with policies: %d\n", data.Summary.Failed)
+	}
+	return saveComplianceResults(data), data
+}
+
+// policyInput returns the document policies are evaluated against: the plan
+// when one was given, and the resources parsed from the terraform otherwise.
+func policyInput(collection fileCollection, resources []localResource) (interface{}, error) {
+	if collection.planPath != "" {
+		for _, file := range collection.files {
+			if file.relativePath != collection.planPath {
+				continue
+			}
+			src, err := file.read()
+			if err != nil {
+				return nil, err
+			}
+			var plan interface{}
+			if err := json.Unmarshal(src, &plan); err != nil {
+				return nil, fmt.Errorf("failed to parse plan %s: %v", file.path, err)
+			}
+			return plan, nil
+		}
+	}
+
+	// Resources by type and name, as in conftest's terraform input, and as a
+	// list with their locations for policies that need modules or files.
+	byType := map[string]map[string]interface{}{}
+	list := []interface{}{}
+	for _, resource := range resources {
+		values := bodyValues(resource.body, resource.ctx)
+		if byType[resource.typeName] == nil {
+			byType[resource.typeName] = map[string]interface{}{}
+		}
+		if resource.moduleDir == "" {
+			byType[resource.typeName][resource.name] = values
+		}
+		list = append(list, map[string]interface{}{
+			"address": resource.typeName + "." + resource.name,
+			"type":    resource.typeName,
+			"name":    resource.name,
+			"module":  resource.moduleDir,
+			"file":    resource.file.relativePath,
+			"line":    resource.block.Range().Start.Line,
+			"values":  values,
+		})
+	}
+	return map[string]interface{}{"resource": byType, "resources": list}, nil
+}
+
+// bodyValues returns the attributes of a block that are known before apply,
+// with nested blocks as lists of objects under their type.
+func bodyValues(body *hclsyntax.Body, ctx *hcl.EvalContext) map[string]interface{} {
+	values := map[string]interface{}{}
+	for attributeName, attr := range body.Attributes {
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() || !value.IsWhollyKnown() {
+			continue
+		}
+		data, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err == nil {
+			values[attributeName] = decoded
+		}
+	}
+	for _, block := range body.Blocks {
+		nested, _ := values[block.Type].([]interface{})
+		values[block.Type] = append(nested, bodyValues(block.Body, ctx))
+	}
+	return values
+}
+
+// evaluatePolicies loads the Rego modules and data files in dir, skipping
+// tests, and collects the deny and warn messages of every package.
+func evaluatePolicies(dir string, input interface{}) (denied []policyMessage, warned []policyMessage, err error) {
+	loaded, err := loader.NewFileLoader().Filtered([]string{dir}, func(abspath string, info fs.FileInfo, depth int) bool {
+		return !info.IsDir() && strings.HasSuffix(info.Name(), "_test.rego")
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load policies from %s: %v", dir, err)
+	}
+	if len(loaded.Modules) == 0 {
+		return nil, nil, fmt.Errorf("no Rego policies found in %s", dir)
+	}
+	store, err := loaded.Store()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []func(*rego.Rego){rego.Query("data"), rego.Input(input), rego.Store(store)}
+	packages := map[string]bool{}
+	for _, module := range loaded.ParsedModules() {
+		options = append(options, rego.ParsedModule(module))
+		packages[strings.TrimPrefix(module.Package.Path.String(), "data.")] = true
+	}
+	results, err := rego.New(options...).Eval(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to evaluate policies: %v", err)
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, nil, nil
+	}
+	document := results[0].Expressions[0].Value
+
+	var names []string
+	for pkg := range packages {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+	for _, pkg := range names {
+		var values map[string]interface{}
+		if node, ok := lookupPackage(document, pkg); ok {
+			values = node
+		}
+		for _, rule := range denyRules {
+			denied = append(denied, policyMessages(pkg, values[rule])...)
+		}
+		for _, rule := range warnRules {
+			warned = append(warned, policyMessages(pkg, values[rule])...)
+		}
+	}
+	return denied, warned, nil
+}
+
+// lookupPackage returns the document of a package in the evaluated data.
+func lookupPackage(document interface{}, pkg string) (map[string]interface{}, bool) {
+	ref, err := ast.ParseRef("data." + pkg)
+	if err != nil {
+		return nil, false
+	}
+	node := document
+	for _, term := range ref[1:] {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		key, ok := term.Value.(ast.String)
+		if !ok {
+			return nil, false
+		}
+		node = object[string(key)]
+	}
+	object, ok := node.(map[string]interface{})
+	return object, ok
+}
+
+// policyMessages reads the messages of a deny or warn rule. A message is a
+// string, or an object with msg and optionally id and resource. Messages
+// without an id use the package name.
+func policyMessages(pkg string, value interface{}) (messages []policyMessage) {
+	var items []interface{}
+	switch value := value.(type) {
+	case []interface{}:
+		items = value
+	case nil:
+		return nil
+	default:
+		items = []interface{}{value}
+	}
+	for _, item := range items {
+		message := policyMessage{id: pkg}
+		switch item := item.(type) {
+		case string:
+			message.message = item
+		case map[string]interface{}:
+			message.message, _ = item["msg"].(string)
+			if id, ok := item["id"].(string); ok && id != "" {
+				message.id = id
+			}
+			message.resource, _ = item["resource"].(string)
+		default:
+			data, _ := json.Marshal(item)
+			message.message = string(data)
+		}
+		if message.resource == "" {
+			message.resource = mentionedAddress(message.message)
+		}
+		messages = append(messages, message)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].id != messages[j].id {
+			return messages[i].id < messages[j].id
+		}
+		return messages[i].message < messages[j].message
+	})
+	return messages
+}
+
+// mentionedAddress returns the first word of a message that looks like a
+// resource address, such as aws_s3_bucket.logs or module.net.aws_vpc.main.
+func mentionedAddress(message string) string {
+	for _, word := range strings.Fields(message) {
+		word = strings.Trim(word, `"'`+"`,;:()")
+		parts := strings.Split(resourceTypeAndName(word), ".")
+		if len(parts) == 2 && strings.Contains(parts[0], "_") && parts[1] != "" {
+			return word
+		}
+	}
+	return ""
+}
+
+// resourceTypeAndName strips module prefixes and instance keys from an
+// address, leaving type.name.
+func resourceTypeAndName(address string) string {
+	if i := strings.Index(address, "["); i >= 0 {
+		address = address[:i]
+	}
+	parts := strings.Split(address, ".")
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicyMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []policyMessage
+	}{
+		{"no messages", nil, nil},
+		{"empty set", []interface{}{}, nil},
+		{
+			"strings sorted",
+			[]interface{}{"tags are missing", "bucket is public"},
+			[]policyMessage{
+				{id: "terraform.s3", message: "bucket is public"},
+				{id: "terraform.s3", message: "tags are missing"},
+			},
+		},
+		{
+			"single string",
+			"encryption is off",
+			[]policyMessage{{id: "terraform.s3", message: "encryption is off"}},
+		},
+		{
+			"objects with id and resource",
+			[]interface{}{
+				map[string]interface{}{"msg": "not encrypted", "id": "S3_2", "resource": "aws_s3_bucket.logs"},
+				map[string]interface{}{"msg": "public", "id": "S3_1"},
+			},
+			[]policyMessage{
+				{id: "S3_1", message: "public"},
+				{id: "S3_2", message: "not encrypted", resource: "aws_s3_bucket.logs"},
+			},
+		},
+		{
+			"object with an empty id",
+			map[string]interface{}{"msg": "public", "id": ""},
+			[]policyMessage{{id: "terraform.s3", message: "public"}},
+		},
+		{
+			"resource found in the message",
+			[]interface{}{"module.net.aws_vpc.main[0] has no flow logs", "`aws_s3_bucket.logs`, is public"},
+			[]policyMessage{
+				{id: "terraform.s3", message: "`aws_s3_bucket.logs`, is public", resource: "aws_s3_bucket.logs"},
+				{id: "terraform.s3", message: "module.net.aws_vpc.main[0] has no flow logs", resource: "module.net.aws_vpc.main[0]"},
+			},
+		},
+		{
+			"no address in the message",
+			"see docs.example.com for details",
+			[]policyMessage{{id: "terraform.s3", message: "see docs.example.com for details"}},
+		},
+		{
+			"other values as json",
+			[]interface{}{[]interface{}{"a", "b"}},
+			[]policyMessage{{id: "terraform.s3", message: `["a","b"]`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if messages := policyMessages("terraform.s3", test.value); !reflect.DeepEqual(messages, test.want) {
+				t.Errorf("messages = %+v, want %+v", messages, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	projectsPage     int
+	projectsPageSize int
+	projectsName     string
+	projectsSince    string
+	projectsUntil    string
+	olderThan        string
+	assumeYes        bool
+)
+
+// A project on the maze server.
+type mazeProject struct {
+	ID          flexibleID `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Provider    string     `json:"provider"`
+	// Compliance summary of the project's last plan, when the server has one.
+	Compliance *Summary `json:"compliance,omitempty"`
+}
+
+// A page of projects, for servers that paginate the list.
+type projectPage struct {
+	Count   int           `json:"count"`
+	Next    string        `json:"next"`
+	Results []mazeProject `json:"results"`
+}
+
+// An ID the server may send as a string or a number.
+type flexibleID string
+
+func (id *flexibleID) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*id = flexibleID(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*id = flexibleID(number.String())
+	return nil
+}
+
+// projectsCmd represents the projects command
+var projectsCmd = &cobra.Command{
+	Use:   "projects",
+	Short: ux.ShortTextProjects,
+	Long:  ux.LongTextProjects,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// projectsListCmd represents the projects list command
+var projectsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: ux.ShortTextProjectsList,
+	Long:  ux.LongTextProjectsList,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := listProjects(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// projectsShowCmd represents the projects show command
+var projectsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: ux.ShortTextProjectsShow,
+	Long:  ux.LongTextProjectsShow,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := showProject(args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// projectsOpenCmd represents the projects open command
+var projectsOpenCmd = &cobra.Command{
+	Use:   "open <id>",
+	Short: ux.ShortTextProjectsOpen,
+	Long:  ux.LongTextProjectsOpen,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		canvasURL := url + "/projects/" + neturl.PathEscape(args[0]) + "/canvas"
+		fmt.Println("Opening", canvasURL)
+		ux.OpenBrowser(canvasURL)
+	},
+}
+
+// projectsDeleteCmd represents the projects delete command
+var projectsDeleteCmd = &cobra.Command{
+	Use:   "delete <id>... | --older-than <age>",
+	Short: ux.ShortTextProjectsDelete,
+	Long:  ux.LongTextProjectsDelete,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (len(args) == 0) == (olderThan == "") {
+			fmt.Println("Give the ids of the projects to delete, or --older-than")
+			os.Exit(1)
+		}
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := deleteProjects(args); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// projectsRequest sends an authorized request to the projects API and
+// returns the body of a successful response.
+func projectsRequest(method string, path string) ([]byte, error) {
+	req, err := http.NewRequest(method, url+"/api/projects/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+
+	resp, err := doAuthorized(httpClient(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent:
+		return bodyBytes, nil
+	case http.StatusNotFound:
+		return nil, errors.New("project not found")
+	default:
+		return nil, responseError(resp, bodyBytes)
+	}
+}
+
+// fetchProjects returns a page of projects, filtered by name and creation
+// date. The filters are sent to the server and applied again locally for
+// servers that ignore them. It also reports whether there are more pages.
+func fetchProjects(page int, pageSize int, since time.Time, until time.Time) (projects []mazeProject, total int, more bool, err error) {
+	query := neturl.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	if projectsName != "" {
+		query.Set("search", projectsName)
+	}
+	if !since.IsZero() {
+		query.Set("created_after", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		query.Set("created_before", until.Format(time.RFC3339))
+	}
+	bodyBytes, err := projectsRequest("GET", "?"+query.Encode())
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	var all []mazeProject
+	var paginated projectPage
+	if err := json.Unmarshal(bodyBytes, &all); err == nil {
+		// Servers that return every project at once are filtered and
+		// paginated here.
+		all = filterProjects(all, since, until)
+		total = len(all)
+		start := min((page-1)*pageSize, len(all))
+		end := min(start+pageSize, len(all))
+		return all[start:end], total, end < len(all), nil
+	} else if err := json.Unmarshal(bodyBytes, &paginated); err == nil {
+		return filterProjects(paginated.Results, since, until), paginated.Count, paginated.Next != "", nil
+	}
+	return nil, 0, false, errors.New("the project list could not be read")
+}
+
+// filterProjects returns the projects matching --search and created between
+// since and until.
+func filterProjects(all []mazeProject, since time.Time, until time.Time) (projects []mazeProject) {
+	for _, project := range all {
+		if projectsName != "" && !strings.Contains(strings.ToLower(project.Name), strings.ToLower(projectsName)) {
+			continue
+		}
+		if (!since.IsZero() && project.CreatedAt.Before(since)) || (!until.IsZero() && project.CreatedAt.After(until)) {
+			continue
+		}
+		projects = append(projects, project)
+	}
+	return projects
+}
+
+func listProjects() error {
+	since, err := parseDateOrAge(projectsSince)
+	if err != nil {
+		return err
+	}
+	until, err := parseDateOrAge(projectsUntil)
+	if err != nil {
+		return err
+	}
+	if projectsPage < 1 || projectsPageSize < 1 {
+		return errors.New("page and page size need to be at least 1")
+	}
+	if !authStep() {
+		return errors.New("authentication failed")
+	}
+
+	projects, total, more, err := fetchProjects(projectsPage, projectsPageSize, since, until)
+	if err != nil {
+		return fmt.Errorf("could not list projects: %v", err)
+	}
+	if len(projects) == 0 {
+		fmt.Println("No projects found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("ID")+"\t"+ux.BlueColor("NAME")+"\t"+ux.BlueColor("PROVIDER")+"\t"+ux.BlueColor("CREATED"))
+	for _, project := range projects {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", project.ID, project.Name, project.Provider, formatCreated(project.CreatedAt))
+	}
+	w.Flush()
+	if more {
+		fmt.Printf("\nPage %d of %d projects, use --page %d for more\n", projectsPage, total, projectsPage+1)
+	}
+	return nil
+}
+
+func showProject(id string) error {
+	if !authStep() {
+		return errors.New("authentication failed")
+	}
+	bodyBytes, err := projectsRequest("GET", neturl.PathEscape(id)+"/")
+	if err != nil {
+		return fmt.Errorf("could not get project %s: %v", id, err)
+	}
+	var project mazeProject
+	if err := json.Unmarshal(bodyBytes, &project); err != nil {
+		return fmt.Errorf("could not read project %s: %v", id, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("ID"), project.ID)
+	fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("Name"), project.Name)
+	if project.Description != "" {
+		fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("Description"), project.Description)
+	}
+	fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("Provider"), project.Provider)
+	fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("Created"), formatCreated(project.CreatedAt))
+	fmt.Fprintf(w, "%s\t%s\n", ux.BlueColor("Canvas"), url+"/projects/"+neturl.PathEscape(id)+"/canvas")
+	w.Flush()
+	fmt.Println()
+
+	if project.Compliance != nil {
+		fmt.Printf("Compliance:\n")
+		fmt.Printf("    Passed: %d\n", project.Compliance.Passed)
+		fmt.Printf("    Failed: %d\n", project.Compliance.Failed)
+	} else {
+		fmt.Println("No compliance results for this project")
+	}
+	costStep(id)
+	return nil
+}
+
+func deleteProjects(ids []string) error {
+	var cutoff time.Time
+	if olderThan != "" {
+		age, err := parseAge(olderThan)
+		if err != nil {
+			return err
+		}
+		cutoff = time.Now().Add(-age)
+	}
+	if !authStep() {
+		return errors.New("authentication failed")
+	}
+
+	if olderThan != "" {
+		for page, more := 1, true; more; page++ {
+			var projects []mazeProject
+			var err error
+			if projects, _, more, err = fetchProjects(page, 100, time.Time{}, cutoff); err != nil {
+				return fmt.Errorf("could not list projects: %v", err)
+			}
+			for _, project := range projects {
+				if !project.CreatedAt.IsZero() {
+					ids = append(ids, string(project.ID))
+					fmt.Printf(" - %s %s (created %s)\n", project.ID, project.Name, formatCreated(project.CreatedAt))
+				}
+			}
+		}
+		if len(ids) == 0 {
+			fmt.Println("No projects older than", olderThan)
+			return nil
+		}
+	}
+
+	if !assumeYes {
+		fmt.Printf("Delete %d project(s)? This cannot be undone [y/N]: ", len(ids))
+		var answer string
+		fmt.Scanln(&answer)
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Nothing deleted")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		var deleteSpinner = ux.NewSpinner("Deleting project "+id, "Deleted project "+id, "Deleting project "+id+" failed", false)
+		deleteSpinner.Start()
+		if _, err := projectsRequest("DELETE", neturl.PathEscape(id)+"/"); err != nil {
+			deleteSpinner.Fail()
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		deleteSpinner.Success()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d projects could not be deleted", failed, len(ids))
+	}
+	return nil
+}
+
+// parseAge reads an age such as 30d, 2w or 12h.
+func parseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			count, err := strconv.Atoi(number)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q, use something like 30d, 2w or 12h", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q, use something like 30d, 2w or 12h", value)
+	}
+	return age, nil
+}
+
+// parseDateOrAge reads a date such as 2024-06-30, or an age such as 30d
+// meaning that long ago. An empty value is the zero time.
+func parseDateOrAge(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or an age like 30d", value)
+	}
+	return time.Now().Add(-age), nil
+}
+
+func formatCreated(created time.Time) string {
+	if created.IsZero() {
+		return "-"
+	}
+	return created.Local().Format("2006-01-02 15:04")
+}
+
+func init() {
+
+	for _, command := range []*cobra.Command{projectsListCmd, projectsShowCmd, projectsOpenCmd, projectsDeleteCmd} {
+		command.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to get the auth token from")
+		command.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+		addClientFlags(command)
+		projectsCmd.AddCommand(command)
+		command.SetOutput(color.Output)
+	}
+	projectsListCmd.Flags().IntVarP(&projectsPage, "page", "", 1, "The page of projects to show")
+	projectsListCmd.Flags().IntVarP(&projectsPageSize, "page-size", "", 20, "How many projects to show per page")
+	projectsListCmd.Flags().StringVarP(&projectsName, "search", "", "", "Only list projects whose name contains this")
+	projectsListCmd.Flags().StringVarP(&projectsSince, "since", "", "", "Only list projects created since a date (YYYY-MM-DD) or age (30d)")
+	projectsListCmd.Flags().StringVarP(&projectsUntil, "until", "", "", "Only list projects created before a date (YYYY-MM-DD) or age (30d)")
+	projectsDeleteCmd.Flags().StringVarP(&olderThan, "older-than", "", "", "Delete every project created longer ago than this, e.g. 30d")
+	projectsDeleteCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Delete without asking for confirmation")
+	projectsCmd.SetOutput(color.Output)
+
+}
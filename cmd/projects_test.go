@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{" 7d ", 7 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"-3d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"30", 0, true},
+		{"month", 0, true},
+		{"", 0, true},
+	}
+	for _, test := range tests {
+		age, err := parseAge(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseAge(%q) error = %v, want an error: %v", test.value, err, test.wantErr)
+			continue
+		}
+		if age != test.want {
+			t.Errorf("parseAge(%q) = %s, want %s", test.value, age, test.want)
+		}
+	}
+}
+
+func TestParseDateOrAge(t *testing.T) {
+	if date, err := parseDateOrAge(""); err != nil || !date.IsZero() {
+		t.Errorf("parseDateOrAge(\"\") = %v, %v, want the zero time", date, err)
+	}
+
+	date, err := parseDateOrAge("2024-06-30")
+	if want := time.Date(2024, 6, 30, 0, 0, 0, 0, time.Local); err != nil || !date.Equal(want) {
+		t.Errorf("parseDateOrAge(2024-06-30) = %v, %v, want %v", date, err, want)
+	}
+
+	before := time.Now()
+	date, err = parseDateOrAge("2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ago := before.Sub(date); ago < 48*time.Hour-time.Minute || ago > 48*time.Hour+time.Minute {
+		t.Errorf("parseDateOrAge(2d) is %s ago, want 48h", ago)
+	}
+
+	for _, value := range []string{"2024-13-01", "30/06/2024", "soon"} {
+		if _, err := parseDateOrAge(value); err == nil {
+			t.Errorf("parseDateOrAge(%q) should fail", value)
+		}
+	}
+}
+
+func TestFetchProjectsFiltersBeforePaging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A server that ignores the filters and the page it was asked for.
+		w.Write([]byte(`[
+			{"id": 1, "name": "app-dev", "created_at": "2024-06-01T00:00:00Z"},
+			{"id": 2, "name": "app-staging", "created_at": "2024-06-02T00:00:00Z"},
+			{"id": 3, "name": "network", "created_at": "2024-06-03T00:00:00Z"},
+			{"id": 4, "name": "shop-prod", "created_at": "2024-06-04T00:00:00Z"},
+			{"id": 5, "name": "app-prod", "created_at": "2024-06-05T00:00:00Z"}
+		]`))
+	}))
+	defer server.Close()
+
+	serverURL, search := url, projectsName
+	defer func() { url, projectsName = serverURL, search }()
+	url = server.URL
+
+	tests := []struct {
+		name      string
+		search    string
+		since     time.Time
+		page      int
+		wantIDs   []flexibleID
+		wantTotal int
+		wantMore  bool
+	}{
+		{"hit beyond the first page", "shop", time.Time{}, 1, []flexibleID{"4"}, 1, false},
+		{"first page of the hits", "app", time.Time{}, 1, []flexibleID{"1", "2"}, 3, true},
+		{"last page of the hits", "app", time.Time{}, 2, []flexibleID{"5"}, 3, false},
+		{"created since", "", time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC), 1, []flexibleID{"4", "5"}, 2, false},
+		{"past the hits", "shop", time.Time{}, 2, nil, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projectsName = test.search
+			projects, total, more, err := fetchProjects(test.page, 2, test.since, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []flexibleID
+			for _, project := range projects {
+				ids = append(ids, project.ID)
+			}
+			if len(ids) != len(test.wantIDs) {
+				t.Fatalf("projects = %v, want %v", ids, test.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != test.wantIDs[i] {
+					t.Fatalf("projects = %v, want %v", ids, test.wantIDs)
+				}
+			}
+			if total != test.wantTotal || more != test.wantMore {
+				t.Errorf("total, more = %d, %v, want %d, %v", total, more, test.wantTotal, test.wantMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The provider types maze analyses.
+var analysedProviders = map[string]bool{"aws": true, "azurerm": true, "google": true}
+
+// Short names accepted by --provider for the analysed provider types.
+var providerAliases = map[string]string{
+	"azure":       "azurerm",
+	"gcp":         "google",
+	"google-beta": "google",
+}
+
+// A provider found in the terraform files.
+type detectedProvider struct {
+	// Provider type, such as aws or azurerm.
+	name string
+	// Registry source from required_providers.
+	source  string
+	aliases []string
+	regions []string
+}
+
+// detectProviders reads the providers in use from required_providers and
+// provider blocks.
+func detectProviders(files []collectedFile) (providers []detectedProvider) {
+	byName := map[string]*detectedProvider{}
+	// required_providers may give a provider a local name that differs from
+	// its type, which provider blocks then use.
+	localNames := map[string]string{}
+	get := func(name string) *detectedProvider {
+		if typeName, exists := localNames[name]; exists {
+			name = typeName
+		}
+		if _, exists := byName[name]; !exists {
+			byName[name] = &detectedProvider{name: name}
+		}
+		return byName[name]
+	}
+
+	var bodies []*hclsyntax.Body
+	for _, file := range files {
+		if !isConfigFile(file.path) {
+			continue
+		}
+		if body, err := parseHCLFile(file.path); err == nil {
+			bodies = append(bodies, body)
+		}
+	}
+
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			for _, nested := range block.Body.Blocks {
+				if nested.Type != "required_providers" {
+					continue
+				}
+				for localName, attr := range nested.Body.Attributes {
+					source := ""
+					if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type().IsObjectType() && value.Type().HasAttribute("source") {
+						if sourceValue := value.GetAttr("source"); sourceValue.Type() == cty.String && sourceValue.IsKnown() && !sourceValue.IsNull() {
+							source = sourceValue.AsString()
+						}
+					}
+					typeName := localName
+					if source != "" {
+						typeName = strings.ToLower(source[strings.LastIndex(source, "/")+1:])
+					}
+					localNames[localName] = typeName
+					if provider := get(typeName); provider.source == "" {
+						provider.source = source
+					}
+				}
+			}
+		}
+	}
+
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "provider" || len(block.Labels) != 1 {
+				continue
+			}
+			provider := get(block.Labels[0])
+			if alias, ok := literalString(block.Body, "alias"); ok {
+				provider.aliases = append(provider.aliases, alias)
+			}
+			for _, regionAttribute := range []string{"region", "location"} {
+				if region, ok := literalString(block.Body, regionAttribute); ok {
+					provider.regions = append(provider.regions, region)
+				}
+			}
+		}
+	}
+
+	for _, provider := range byName {
+		provider.aliases = uniqueSorted(provider.aliases)
+		provider.regions = uniqueSorted(provider.regions)
+		providers = append(providers, *provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].name < providers[j].name })
+	return providers
+}
+
+// providerType turns a --provider value into a terraform provider type.
+func providerType(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if typeName, exists := providerAliases[name]; exists {
+		return typeName
+	}
+	return name
+}
+
+// splitProviders separates the providers maze analyses from the rest.
+func splitProviders(names []string) (analysed []string, notAnalysed []string) {
+	for _, name := range names {
+		if analysedProviders[name] {
+			analysed = append(analysed, name)
+		} else {
+			notAnalysed = append(notAnalysed, name)
+		}
+	}
+	return analysed, notAnalysed
+}
+
+// resourceProvider returns the provider type of a resource address such as
+// module.network.aws_vpc.main, or an empty string.
+func resourceProvider(address string) string {
+	parts := strings.Split(address, ".")
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	if len(parts) > 0 && parts[0] == "data" {
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	typeName, _, _ := strings.Cut(parts[0], "_")
+	return providerType(typeName)
+}
+
+// detectProviderStep looks for the providers in --dir and in the modules it
+// uses, and prints them. It returns their provider types.
+func detectProviderStep() (names []string) {
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil
+	}
+	// Errors are reported when the files are read for the upload.
+	collection, err := collectSources(root)
+	if err != nil {
+		return nil
+	}
+	providers := detectProviders(collection.files)
+	if len(providers) == 0 {
+		return nil
+	}
+
+	fmt.Println("Detected providers:")
+	for _, provider := range providers {
+		line := " - " + provider.name
+		if provider.source != "" {
+			line += " (" + provider.source + ")"
+		}
+		if len(provider.aliases) > 0 {
+			line += ", aliases: " + strings.Join(provider.aliases, ", ")
+		}
+		if len(provider.regions) > 0 {
+			line += ", regions: " + strings.Join(provider.regions, ", ")
+		}
+		if !analysedProviders[providerType(provider.name)] {
+			line += ", not analysed"
+		}
+		fmt.Println(line)
+		names = append(names, providerType(provider.name))
+	}
+	fmt.Println()
+	return uniqueSorted(names)
+}
+
+const noProviderMessage = "No provider maze analyses was found, use --provider or .maze.yaml with aws, azure or gcp"
+
+// stdinIsTerminal reports whether stdin is a terminal someone can answer a
+// prompt from.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// providerStep settles the providers of the run from --provider, from what
+// was detected or, when neither names a provider maze analyses, from a
+// prompt.
+func providerStep() (success bool) {
+	detected := detectProviderStep()
+	if len(providers) == 0 && len(detected) > 0 {
+		providers = detected
+		fmt.Printf("Using the detected providers %s (to change use --provider)\n\n", strings.Join(providers, ", "))
+	}
+	for i := range providers {
+		providers[i] = providerType(providers[i])
+	}
+	providers = uniqueSorted(providers)
+
+	analysed, notAnalysed := splitProviders(providers)
+	if len(analysed) == 0 && (summaryFile != "" || !stdinIsTerminal()) {
+		// Runs started by --recursive, and runs in CI, have no one to answer
+		// the prompt.
+		fmt.Println(noProviderMessage)
+		return false
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for len(analysed) == 0 {
+		fmt.Println("Enter the providers you are using, separated by commas - aws/azure/gcp (use --provider to pass in providers):")
+		answer, err := reader.ReadString('\n')
+		for _, name := range strings.Split(answer, ",") {
+			if name = providerType(name); name != "" {
+				providers = append(providers, name)
+			}
+		}
+		providers = uniqueSorted(providers)
+		if analysed, notAnalysed = splitProviders(providers); len(analysed) > 0 {
+			break
+		}
+		if err != nil {
+			// Stdin was closed before a provider was given.
+			fmt.Println(noProviderMessage)
+			return false
+		}
+		fmt.Println("At least one provider needs to be aws, azure or gcp")
+	}
+
+	if len(notAnalysed) > 0 {
+		fmt.Printf("Not analysed: %s (maze analyses aws, azurerm and google)\n\n", strings.Join(notAnalysed, ", "))
+	}
+	return true
+}
+
+// providerPayload is the provider part of the validate and plan requests.
+// provider is kept for servers that only know a single provider.
+func providerPayload() map[string]interface{} {
+	analysed, _ := splitProviders(providers)
+	return map[string]interface{}{
+		"provider":  analysed[0],
+		"providers": providers,
+	}
+}
+
+// printProviderBreakdown prints cost and failed compliance checks for each
+// provider of the run.
+func printProviderBreakdown(data Response, cost Cost, costCalculated bool) {
+	if len(providers) < 2 {
+		return
+	}
+	hourlyCost := map[string]float64{}
+	for _, resource := range cost.Resources {
+		hourlyCost[resourceProvider(resource.Resource)] += resource.HourlyCost
+	}
+	failedChecks := map[string]int{}
+	for _, check := range data.Results.FailedChecks {
+		failedChecks[resourceProvider(check.Resource)]++
+	}
+
+	fmt.Println("By provider:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("PROVIDER")+"\t"+ux.BlueColor("MONTHLY COST")+"\t"+ux.BlueColor("FAILED CHECKS"))
+	for _, name := range providers {
+		if !analysedProviders[name] {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, "not analysed", "not analysed")
+			continue
+		}
+		monthlyCost := "-"
+		if costCalculated {
+			monthlyCost = fmt.Sprint("$", roundFloat(hourlyCost[name]*730, 2))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", name, monthlyCost, failedChecks[name])
+	}
+	w.Flush()
+	fmt.Println()
+}
@@ -0,0 +1,375 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"maze/cmd/ux"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Outcomes of a plan run, from best to worst.
+const (
+	planStatusOK         = "ok"
+	planStatusThresholds = "thresholds exceeded"
+	planStatusFailed     = "failed"
+)
+
+var (
+	recursive     bool
+	parallelRoots int
+	// Where a plan run writes its planSummary, used by --recursive to hear
+	// back from the run of each root.
+	summaryFile string
+	planResult  planSummary
+)
+
+// The outcome of planning one root module.
+type planSummary struct {
+	Root           string  `json:"root"`
+	Status         string  `json:"status"`
+	ProjectID      string  `json:"projectId,omitempty"`
+	CanvasURL      string  `json:"canvasUrl,omitempty"`
+	CostCalculated bool    `json:"costCalculated"`
+	MonthlyCost    float64 `json:"monthlyCost"`
+	PassedChecks   int     `json:"passedChecks"`
+	FailedChecks   int     `json:"failedChecks"`
+	Log            string  `json:"log,omitempty"`
+}
+
+// Flags that only make sense for the run that drives --recursive. The name is
+// given to each root by rootProjectName instead.
+var recursiveOnlyFlags = map[string]bool{"dir": true, "recursive": true, "parallel": true, "summary-file": true, "name": true}
+
+// writePlanSummary records the outcome of mazePlan for the --recursive run
+// that started it.
+func writePlanSummary(planErr error) {
+	planResult.Root = dirPath
+	switch {
+	case planResult.ProjectID == "":
+		planResult.Status = planStatusFailed
+	case planErr != nil:
+		planResult.Status = planStatusThresholds
+	default:
+		planResult.Status = planStatusOK
+	}
+	data, err := json.MarshalIndent(planResult, "", "  ")
+	if err == nil {
+		err = os.WriteFile(summaryFile, data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write summary: %v\n", err)
+	}
+}
+
+// findRoots returns the root modules below dir: directories whose terraform
+// files configure a backend or a provider, or that have a project
+// configuration file of their own.
+func findRoots(dir string) (roots []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	matcher := newIgnoreMatcher(includeGlobs, excludeGlobs)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path: %v", err)
+		}
+		if relativePath != "." {
+			if strings.HasPrefix(info.Name(), ".") || info.Name() == "maze-output" || info.Name() == filepath.Base(outputDir) {
+				return filepath.SkipDir
+			}
+			if matcher.ignored(relativePath, true) {
+				return filepath.SkipDir
+			}
+		} else {
+			relativePath = ""
+		}
+		if err := matcher.loadDir(path, filepath.ToSlash(relativePath), useGitignore); err != nil {
+			return err
+		}
+		if isRootModule(path) {
+			roots = append(roots, path)
+		}
+		return nil
+	})
+	return roots, err
+}
+
+// isRootModule reports whether dir holds a root module rather than a module
+// that is only called by others.
+func isRootModule(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	hasConfig, hasProjectConfig := false, false
+	for _, entry := range entries {
+		for _, configName := range projectConfigNames {
+			if entry.Name() == configName {
+				hasProjectConfig = true
+			}
+		}
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+		hasConfig = true
+		body, err := parseHCLFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type == "provider" {
+				return true
+			}
+			if block.Type != "terraform" {
+				continue
+			}
+			for _, nested := range block.Body.Blocks {
+				if nested.Type == "backend" || nested.Type == "cloud" {
+					return true
+				}
+			}
+		}
+	}
+	return hasConfig && hasProjectConfig
+}
+
+// planRoots runs the plan pipeline for every root module below --dir, at
+// most --parallel at a time, and prints a combined report. It fails when any
+// root failed or exceeded its thresholds.
+func planRoots(cmd *cobra.Command) error {
+	if planJSONPath != "" || planFilePath != "" {
+		fmt.Println("--plan-json and --plan-file describe a single root and cannot be used with --recursive")
+		return errors.New("invalid flags")
+	}
+	if parallelRoots < 1 {
+		fmt.Println("Parallel needs to be at least 1")
+		return errors.New("invalid flags")
+	}
+
+	var findSpinner = ux.NewSpinner("Looking for root modules", "Found root modules", "Looking for root modules failed", false)
+	findSpinner.Start()
+	roots, err := findRoots(dirPath)
+	if err != nil {
+		findSpinner.Fail()
+		fmt.Println(err)
+		return err
+	}
+	if len(roots) == 0 {
+		findSpinner.Fail("No root modules found in " + dirPath)
+		return errors.New("no root modules")
+	}
+	findSpinner.Success(fmt.Sprintf("Found %d root modules", len(roots)))
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	args := forwardedFlags(cmd)
+
+	summaries := make([]planSummary, len(roots))
+	workers := make(chan struct{}, parallelRoots)
+	var wg sync.WaitGroup
+	var printLock sync.Mutex
+	for i, root := range roots {
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			summaries[i] = planRoot(executable, root, roots, args)
+
+			printLock.Lock()
+			defer printLock.Unlock()
+			mark := ux.PrintGreen("✔")
+			if summaries[i].Status != planStatusOK {
+				mark = ux.PrintRed("✘")
+			}
+			fmt.Printf("%s %s: %s\n", mark, displayRoot(root), summaries[i].Status)
+		}(i, root)
+	}
+	wg.Wait()
+
+	printRootSummaries(summaries)
+
+	reportPath := outputPath("maze_recursive_summary.json")
+	if err := os.MkdirAll(filepath.Dir(reportPath), os.ModePerm); err != nil {
+		fmt.Println(err)
+	} else if data, err := json.MarshalIndent(summaries, "", "  "); err != nil {
+		fmt.Println(err)
+	} else if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		fmt.Printf("Failed to write summary: %v\n", err)
+	} else {
+		fmt.Printf("Full summary saved to %s\n", reportPath)
+	}
+
+	worst := planStatusOK
+	for _, summary := range summaries {
+		if summary.Status == planStatusFailed || (summary.Status == planStatusThresholds && worst == planStatusOK) {
+			worst = summary.Status
+		}
+	}
+	if worst != planStatusOK {
+		return errors.New(worst)
+	}
+	return nil
+}
+
+// forwardedFlags returns the flags given on the command line as arguments
+// for the plan run of each root.
+func forwardedFlags(cmd *cobra.Command) (args []string) {
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		// --var and --var-file are forwarded below, in their order.
+		if recursiveOnlyFlags[flag.Name] || flag.Name == "var" || flag.Name == "var-file" {
+			return
+		}
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			for _, value := range sliceValue.GetSlice() {
+				args = append(args, "--"+flag.Name, value)
+			}
+			return
+		}
+		args = append(args, "--"+flag.Name+"="+flag.Value.String())
+	})
+	for _, arg := range variableArgs {
+		args = append(args, "--"+arg.flag, arg.value)
+	}
+	return args
+}
+
+// rootProjectName returns the project name of a root: the name its own
+// .maze.yaml sets, or else --name followed by the path of the root below
+// --dir, so that the roots do not all share one name.
+func rootProjectName(root string) string {
+	for _, configName := range projectConfigNames {
+		config, _, err := loadProjectConfig(filepath.Join(root, configName))
+		if err == nil && config.Name != "" {
+			return config.Name
+		}
+	}
+	relativePath := displayRoot(root)
+	if relativePath == "." {
+		return name
+	}
+	return name + "/" + filepath.ToSlash(relativePath)
+}
+
+// planRoot runs maze plan for one root in its own process, so roots can run
+// side by side, and reads back its summary. Roots nested inside it are left
+// to their own runs.
+func planRoot(executable string, root string, roots []string, args []string) (summary planSummary) {
+	summary = planSummary{Root: root, Status: planStatusFailed}
+
+	rootOutput := outputDir
+	if !filepath.IsAbs(rootOutput) {
+		rootOutput = filepath.Join(root, rootOutput)
+	}
+	if err := os.MkdirAll(rootOutput, os.ModePerm); err != nil {
+		return summary
+	}
+	summary.Log = filepath.Join(rootOutput, "maze-plan.log")
+	rootSummaryFile := filepath.Join(rootOutput, "maze-plan-summary.json")
+	os.Remove(rootSummaryFile)
+
+	args = append([]string{"plan", "--dir", root, "--summary-file", rootSummaryFile, "--name", rootProjectName(root)}, args...)
+	for _, other := range roots {
+		if other != root && isWithin(root, other) {
+			relativePath, err := filepath.Rel(root, other)
+			if err == nil {
+				args = append(args, "--exclude", "/"+filepath.ToSlash(relativePath)+"/")
+			}
+		}
+	}
+
+	logFile, err := os.Create(summary.Log)
+	if err != nil {
+		return summary
+	}
+	defer logFile.Close()
+
+	run := exec.Command(executable, args...)
+	run.Stdout = logFile
+	run.Stderr = logFile
+	run.Run()
+
+	data, err := os.ReadFile(rootSummaryFile)
+	if err != nil {
+		return summary
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		summary.Status = planStatusFailed
+	}
+	summary.Root = root
+	summary.Log = filepath.Join(rootOutput, "maze-plan.log")
+	return summary
+}
+
+// printRootSummaries prints cost, compliance failures and the canvas of
+// every root, worst roots first.
+func printRootSummaries(summaries []planSummary) {
+	rank := map[string]int{planStatusFailed: 0, planStatusThresholds: 1, planStatusOK: 2}
+	sorted := append([]planSummary{}, summaries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if rank[sorted[i].Status] != rank[sorted[j].Status] {
+			return rank[sorted[i].Status] < rank[sorted[j].Status]
+		}
+		return sorted[i].Root < sorted[j].Root
+	})
+
+	totalCost := 0.0
+	totalFailed := 0
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, ux.BlueColor("ROOT")+"\t"+ux.BlueColor("STATUS")+"\t"+ux.BlueColor("MONTHLY COST")+"\t"+ux.BlueColor("FAILED CHECKS")+"\t"+ux.BlueColor("CANVAS"))
+	for _, summary := range sorted {
+		monthlyCost := "-"
+		if summary.CostCalculated {
+			monthlyCost = fmt.Sprint("$", roundFloat(summary.MonthlyCost, 2))
+			totalCost += summary.MonthlyCost
+		}
+		canvas := summary.CanvasURL
+		if canvas == "" {
+			canvas = "see " + summary.Log
+		}
+		totalFailed += summary.FailedChecks
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", displayRoot(summary.Root), summary.Status, monthlyCost, summary.FailedChecks, canvas)
+	}
+	fmt.Fprintf(w, "%s\t\t%s\t%d\t\n", ux.BlueColor("TOTAL"), fmt.Sprint("$", roundFloat(totalCost, 2)), totalFailed)
+	w.Flush()
+	fmt.Println()
+}
+
+// displayRoot shortens a root to its path below --dir.
+func displayRoot(root string) string {
+	base, err := filepath.Abs(dirPath)
+	if err != nil {
+		return root
+	}
+	if relativePath, err := filepath.Rel(base, root); err == nil {
+		return relativePath
+	}
+	return root
+}
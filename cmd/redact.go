@@ -0,0 +1,398 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Value uploaded in place of anything sensitive.
+const redactedValue = "REDACTED"
+
+var (
+	redactKeys    []string
+	skipState     bool
+	skipVariables bool
+)
+
+// What was redacted from one file.
+type redaction struct {
+	relativePath string
+	values       []string
+}
+
+// redactStep drops the state and tfvars files the user excluded and masks
+// sensitive values in the rest, so secrets never leave the machine. It
+// returns what was redacted from each file.
+func redactStep(collection *fileCollection) (redactions []redaction, err error) {
+	keyPatterns, err := compileRedactKeys(redactKeys)
+	if err != nil {
+		return nil, err
+	}
+	sensitiveVariables := findSensitiveVariables(collection.files)
+
+	var files []collectedFile
+	for _, file := range collection.files {
+		var values []string
+		switch {
+		case file.relativePath == collection.planPath:
+			file, values, err = redactPlan(file, keyPatterns, sensitiveVariables)
+		case isStateFile(file.path):
+			if skipState {
+				continue
+			}
+			file, values, err = redactState(file, keyPatterns)
+		case isVariablesFile(file.path):
+			if skipVariables {
+				continue
+			}
+			file, values, err = redactVariables(file, keyPatterns, sensitiveVariables)
+		case isTerragruntFile(file.path):
+			file, values, err = redactTerragrunt(file, keyPatterns, sensitiveVariables)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			redactions = append(redactions, redaction{file.relativePath, values})
+		}
+		files = append(files, file)
+	}
+	collection.files = files
+	return redactions, nil
+}
+
+// compileRedactKeys turns the --redact-keys patterns into case insensitive
+// regular expressions.
+func compileRedactKeys(patterns []string) (keyPatterns []*regexp.Regexp, err error) {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact key pattern %q: %v", pattern, err)
+		}
+		keyPatterns = append(keyPatterns, re)
+	}
+	return keyPatterns, nil
+}
+
+func matchesKey(keyPatterns []*regexp.Regexp, key string) bool {
+	for _, re := range keyPatterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSensitiveVariables returns the names of the variables declared with
+// sensitive = true in the collected terraform files.
+func findSensitiveVariables(files []collectedFile) map[string]bool {
+	sensitive := map[string]bool{}
+	for _, file := range files {
+		if !isConfigFile(file.path) {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			if attr, exists := block.Body.Attributes["sensitive"]; exists {
+				value, diags := attr.Expr.Value(nil)
+				if !diags.HasErrors() && value.Type() == cty.Bool && value.True() {
+					sensitive[block.Labels[0]] = true
+				}
+			}
+		}
+	}
+	return sensitive
+}
+
+// redactState masks the attributes terraform marked sensitive, the values of
+// sensitive outputs and any attribute whose name matches a redact key.
+func redactState(file collectedFile, keyPatterns []*regexp.Regexp) (collectedFile, []string, error) {
+	data, err := file.read()
+	if err != nil {
+		return file, nil, fmt.Errorf("failed to read file %s: %v", file.path, err)
+	}
+
+	// Numbers are kept as written so large serials survive the round trip.
+	var state map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&state); err != nil {
+		// Not a state file we understand, so upload none of it rather than
+		// risk leaking secrets.
+		return file, nil, fmt.Errorf("could not parse state file %s, use --no-state to skip state files: %v", file.path, err)
+	}
+
+	var values []string
+	if outputs, ok := state["outputs"].(map[string]interface{}); ok {
+		for outputName, output := range outputs {
+			output, ok := output.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if sensitive, _ := output["sensitive"].(bool); sensitive || matchesKey(keyPatterns, outputName) {
+				output["value"] = redactedValue
+				values = append(values, "output."+outputName)
+			}
+		}
+	}
+
+	resources, _ := state["resources"].([]interface{})
+	for _, resource := range resources {
+		resource, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address := fmt.Sprintf("%v.%v", resource["type"], resource["name"])
+		if module, ok := resource["module"].(string); ok {
+			address = module + "." + address
+		}
+		instances, _ := resource["instances"].([]interface{})
+		for _, instance := range instances {
+			instance, ok := instance.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			attributes, ok := instance["attributes"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			paths, _ := instance["sensitive_attributes"].([]interface{})
+			for _, path := range paths {
+				if name, ok := redactStatePath(attributes, path); ok {
+					values = append(values, address+"."+name)
+				}
+			}
+			for _, name := range redactMatchingKeys(attributes, keyPatterns, "") {
+				values = append(values, address+"."+name)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return file, nil, nil
+	}
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return file, nil, fmt.Errorf("failed to write redacted state %s: %v", file.path, err)
+	}
+	file.content = content
+	file.size = int64(len(content))
+	return file, uniqueSorted(values), nil
+}
+
+// redactStatePath masks the value at a sensitive attribute path such as
+// [{"type":"get_attr","value":"password"}].
+func redactStatePath(attributes map[string]interface{}, path interface{}) (string, bool) {
+	steps, ok := path.([]interface{})
+	if !ok || len(steps) == 0 {
+		return "", false
+	}
+
+	var current interface{} = attributes
+	var names []string
+	for i, step := range steps {
+		step, ok := step.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		last := i == len(steps)-1
+		switch container := current.(type) {
+		case map[string]interface{}:
+			key := fmt.Sprint(step["value"])
+			if _, exists := container[key]; !exists {
+				return "", false
+			}
+			names = append(names, key)
+			if last {
+				container[key] = redactedValue
+			}
+			current = container[key]
+		case []interface{}:
+			number, ok := step["value"].(json.Number)
+			if !ok {
+				return "", false
+			}
+			index, err := number.Int64()
+			if err != nil || index < 0 || int(index) >= len(container) {
+				return "", false
+			}
+			names = append(names, number.String())
+			if last {
+				container[index] = redactedValue
+			}
+			current = container[index]
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(names, "."), true
+}
+
+// redactMatchingKeys masks every value, at any depth, whose key matches a
+// redact key and returns the dotted names of the masked values.
+func redactMatchingKeys(value interface{}, keyPatterns []*regexp.Regexp, prefix string) (names []string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if nested == nil || nested == redactedValue {
+				continue
+			}
+			if matchesKey(keyPatterns, key) {
+				value[key] = redactedValue
+				names = append(names, prefix+key)
+				continue
+			}
+			names = append(names, redactMatchingKeys(nested, keyPatterns, prefix+key+".")...)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			names = append(names, redactMatchingKeys(nested, keyPatterns, fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	return names
+}
+
+// redactVariables masks the values of sensitive variables and of keys that
+// match a redact key in a tfvars file. Only the values are replaced, so the
+// rest of the file keeps its layout.
+func redactVariables(file collectedFile, keyPatterns []*regexp.Regexp, sensitiveVariables map[string]bool) (collectedFile, []string, error) {
+	src, err := file.read()
+	if err != nil {
+		return file, nil, fmt.Errorf("failed to read file %s: %v", file.path, err)
+	}
+	hclFile, diags := hclsyntax.ParseConfig(src, file.path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return file, nil, fmt.Errorf("could not parse %s, use --no-tfvars to skip tfvars files: %s", file.path, diags.Error())
+	}
+
+	var values []string
+	var ranges []hcl.Range
+	for variableName, attr := range hclFile.Body.(*hclsyntax.Body).Attributes {
+		if sensitiveVariables[variableName] || matchesKey(keyPatterns, variableName) {
+			values = append(values, variableName)
+			ranges = append(ranges, attr.Expr.Range())
+			continue
+		}
+		nestedValues, nestedRanges := redactObjectKeys(attr.Expr, keyPatterns, variableName+".")
+		values = append(values, nestedValues...)
+		ranges = append(ranges, nestedRanges...)
+	}
+	if len(values) == 0 {
+		return file, nil, nil
+	}
+	return replaceRanges(file, src, ranges), uniqueSorted(values), nil
+}
+
+// redactTerragrunt masks the inputs of a terragrunt configuration file that
+// set sensitive variables or match a redact key, the same way redactVariables
+// does for tfvars files.
+func redactTerragrunt(file collectedFile, keyPatterns []*regexp.Regexp, sensitiveVariables map[string]bool) (collectedFile, []string, error) {
+	src, err := file.read()
+	if err != nil {
+		return file, nil, fmt.Errorf("failed to read file %s: %v", file.path, err)
+	}
+	hclFile, diags := hclsyntax.ParseConfig(src, file.path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return file, nil, fmt.Errorf("could not parse %s: %s", file.path, diags.Error())
+	}
+	attr, exists := hclFile.Body.(*hclsyntax.Body).Attributes["inputs"]
+	if !exists {
+		return file, nil, nil
+	}
+	object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return file, nil, nil
+	}
+
+	var values []string
+	var ranges []hcl.Range
+	for _, item := range object.Items {
+		name := hcl.ExprAsKeyword(item.KeyExpr)
+		if name != "" && (sensitiveVariables[name] || matchesKey(keyPatterns, name)) {
+			values = append(values, "inputs."+name)
+			ranges = append(ranges, item.ValueExpr.Range())
+			continue
+		}
+		nestedValues, nestedRanges := redactObjectKeys(item.ValueExpr, keyPatterns, "inputs."+name+".")
+		values = append(values, nestedValues...)
+		ranges = append(ranges, nestedRanges...)
+	}
+	if len(values) == 0 {
+		return file, nil, nil
+	}
+	return replaceRanges(file, src, ranges), uniqueSorted(values), nil
+}
+
+// replaceRanges uploads src with the expressions at ranges replaced by the
+// redacted value. Only the values are replaced, so the rest of the file
+// keeps its layout.
+func replaceRanges(file collectedFile, src []byte, ranges []hcl.Range) collectedFile {
+	// Replace from the end of the file so earlier offsets stay valid.
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start.Byte > ranges[j].Start.Byte })
+	content := append([]byte{}, src...)
+	for _, r := range ranges {
+		content = append(content[:r.Start.Byte], append([]byte(`"`+redactedValue+`"`), content[r.End.Byte:]...)...)
+	}
+	file.content = content
+	file.size = int64(len(content))
+	return file
+}
+
+// redactObjectKeys finds the values in an object constructor whose keys
+// match a redact key.
+func redactObjectKeys(expr hclsyntax.Expression, keyPatterns []*regexp.Regexp, prefix string) (values []string, ranges []hcl.Range) {
+	switch expr := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		for _, item := range expr.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if key == "" {
+				if value, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && value.Type() == cty.String {
+					key = value.AsString()
+				}
+			}
+			if key != "" && matchesKey(keyPatterns, key) {
+				values = append(values, prefix+key)
+				ranges = append(ranges, item.ValueExpr.Range())
+				continue
+			}
+			nestedValues, nestedRanges := redactObjectKeys(item.ValueExpr, keyPatterns, prefix+key+".")
+			values = append(values, nestedValues...)
+			ranges = append(ranges, nestedRanges...)
+		}
+	case *hclsyntax.TupleConsExpr:
+		for i, item := range expr.Exprs {
+			nestedValues, nestedRanges := redactObjectKeys(item, keyPatterns, fmt.Sprintf("%s%d.", prefix, i))
+			values = append(values, nestedValues...)
+			ranges = append(ranges, nestedRanges...)
+		}
+	}
+	return values, ranges
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func defaultRedactKeys(t *testing.T) []*regexp.Regexp {
+	t.Helper()
+	keyPatterns, err := compileRedactKeys([]string{"password", "secret", "token", "private_key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPatterns
+}
+
+func TestCompileRedactKeys(t *testing.T) {
+	keyPatterns := defaultRedactKeys(t)
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"password", true},
+		{"DB_PASSWORD", true},
+		{"client_secret", true},
+		{"github_token_name", true},
+		{"private_key_pem", true},
+		{"username", false},
+		{"pass", false},
+	}
+	for _, test := range tests {
+		if got := matchesKey(keyPatterns, test.key); got != test.want {
+			t.Errorf("matchesKey(%q) = %v, want %v", test.key, got, test.want)
+		}
+	}
+	if _, err := compileRedactKeys([]string{"("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRedactVariables(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		sensitive  map[string]bool
+		wantValues []string
+		want       string
+	}{
+		{
+			"matching key",
+			"db_password = \"hunter2\"\nregion = \"us-east-1\"\n",
+			nil,
+			[]string{"db_password"},
+			"db_password = \"REDACTED\"\nregion = \"us-east-1\"\n",
+		},
+		{
+			"sensitive variable",
+			"api = \"abc\"\n",
+			map[string]bool{"api": true},
+			[]string{"api"},
+			"api = \"REDACTED\"\n",
+		},
+		{
+			"nested keys",
+			"db = {\n  user = \"admin\"\n  password = \"hunter2\"\n  list = [{ token = \"t\" }]\n}\n",
+			nil,
+			[]string{"db.list.0.token", "db.password"},
+			"db = {\n  user = \"admin\"\n  password = \"REDACTED\"\n  list = [{ token = \"REDACTED\" }]\n}\n",
+		},
+		{
+			"quoted keys",
+			"db = { \"secret\" = \"s\" }\n",
+			nil,
+			[]string{"db.secret"},
+			"db = { \"secret\" = \"REDACTED\" }\n",
+		},
+		{
+			"nothing to redact",
+			"region = \"us-east-1\"\n",
+			nil,
+			nil,
+			"region = \"us-east-1\"\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := collectedFile{path: "test.tfvars", content: []byte(test.content)}
+			redacted, values, err := redactVariables(file, defaultRedactKeys(t), test.sensitive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, test.wantValues) {
+				t.Errorf("values = %v, want %v", values, test.wantValues)
+			}
+			if string(redacted.content) != test.want {
+				t.Errorf("content = %q, want %q", redacted.content, test.want)
+			}
+			if len(values) > 0 && redacted.size != int64(len(redacted.content)) {
+				t.Errorf("size = %d, want %d", redacted.size, len(redacted.content))
+			}
+		})
+	}
+}
+
+func TestRedactTerragrunt(t *testing.T) {
+	content := `include "root" {
+  path = find_in_parent_folders()
+}
+inputs = {
+  region      = "us-east-1"
+  db_password = "hunter2"
+  api_key     = get_env("API_KEY")
+  settings    = { client_secret = "s" }
+}
+`
+	file := collectedFile{path: "terragrunt.hcl", content: []byte(content)}
+	redacted, values, err := redactTerragrunt(file, defaultRedactKeys(t), map[string]bool{"api_key": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"inputs.api_key", "inputs.db_password", "inputs.settings.client_secret"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	for _, secret := range []string{"hunter2", "API_KEY", `"s"`} {
+		if strings.Contains(string(redacted.content), secret) {
+			t.Errorf("%s was not redacted from %s", secret, redacted.content)
+		}
+	}
+	if !strings.Contains(string(redacted.content), "find_in_parent_folders()") || !strings.Contains(string(redacted.content), `"us-east-1"`) {
+		t.Errorf("content changed outside the redacted values: %s", redacted.content)
+	}
+}
+
+func TestRedactState(t *testing.T) {
+	content := `{
+  "version": 4,
+  "serial": 12345678901234567890,
+  "outputs": {
+    "endpoint": {"value": "db.example.com", "type": "string"},
+    "db_url": {"value": "postgres://u:p@db", "type": "string", "sensitive": true},
+    "admin_token": {"value": "t", "type": "string"}
+  },
+  "resources": [
+    {
+      "module": "module.db",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "attributes": {
+            "username": "admin",
+            "master_password": "hunter2",
+            "endpoint": "db.example.com",
+            "tags": [{"secret_tag": "x"}],
+            "connection": {"host": "h", "port": 5432}
+          },
+          "sensitive_attributes": [
+            [{"type": "get_attr", "value": "connection"}, {"type": "get_attr", "value": "host"}],
+            [{"type": "get_attr", "value": "missing"}]
+          ]
+        }
+      ]
+    }
+  ]
+}`
+	file := collectedFile{path: "terraform.tfstate", content: []byte(content)}
+	redacted, values, err := redactState(file, defaultRedactKeys(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"module.db.aws_db_instance.main.connection.host",
+		"module.db.aws_db_instance.main.master_password",
+		"module.db.aws_db_instance.main.tags.0.secret_tag",
+		"output.admin_token",
+		"output.db_url",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	for _, secret := range []string{"hunter2", "postgres://", `"h"`} {
+		if strings.Contains(string(redacted.content), secret) {
+			t.Errorf("%s was not redacted", secret)
+		}
+	}
+	for _, kept := range []string{"12345678901234567890", "db.example.com", "5432", `"admin"`} {
+		if !strings.Contains(string(redacted.content), kept) {
+			t.Errorf("%s was lost from the state", kept)
+		}
+	}
+
+	if _, _, err := redactState(collectedFile{path: "broken.tfstate", content: []byte("{")}, nil); err == nil {
+		t.Error("expected an error for a state file that cannot be parsed")
+	}
+}
@@ -36,6 +36,16 @@ func addSubCommands() {
 
 	rootCmd.AddCommand(planCmd)
 	rootCmd.AddCommand(configureCmd)
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(inventoryCmd)
+	rootCmd.AddCommand(costCmd)
+	rootCmd.AddCommand(catalogCmd)
+	rootCmd.AddCommand(visualizeCmd)
+	rootCmd.AddCommand(complyCmd)
+	rootCmd.AddCommand(projectsCmd)
+	rootCmd.AddCommand(historyCmd)
 }
 func init() {
 
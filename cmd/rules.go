@@ -0,0 +1,530 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// A compliance check run locally against the resources of one type or more.
+// IDs never change or get reused, so they can be suppressed safely.
+type complianceRule struct {
+	id            string
+	name          string
+	resourceTypes []string
+	// check reports whether the resource passes and which attributes it
+	// looked at. Values that are only known after apply never fail a check.
+	check func(resource ruleResource) (passed bool, evaluatedKeys []string)
+}
+
+// A resource block with what is needed to evaluate its attributes.
+type ruleResource struct {
+	typeName string
+	name     string
+	body     *hclsyntax.Body
+	ctx      *hcl.EvalContext
+	// The other resources of the same module, for rules that depend on a
+	// related resource such as a flow log.
+	module []ruleResource
+}
+
+// Ports used to administer machines remotely.
+var adminPorts = []int64{22, 3389}
+
+var complianceRules = []complianceRule{
+	{
+		id:            "MAZE_AWS_1",
+		name:          "Ensure S3 buckets do not grant public access through their ACL",
+		resourceTypes: []string{"aws_s3_bucket", "aws_s3_bucket_acl"},
+		check: func(r ruleResource) (bool, []string) {
+			acl, known := ruleString(r.body, "acl", r.ctx)
+			return !known || (acl != "public-read" && acl != "public-read-write" && acl != "authenticated-read"), []string{"acl"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_2",
+		name:          "Ensure S3 public access blocks block every kind of public access",
+		resourceTypes: []string{"aws_s3_bucket_public_access_block"},
+		check: func(r ruleResource) (bool, []string) {
+			keys := []string{"block_public_acls", "block_public_policy", "ignore_public_acls", "restrict_public_buckets"}
+			for _, key := range keys {
+				if !ruleEnabled(r.body, key, r.ctx) {
+					return false, keys
+				}
+			}
+			return true, keys
+		},
+	},
+	{
+		id:            "MAZE_AWS_3",
+		name:          "Ensure EBS volumes are encrypted",
+		resourceTypes: []string{"aws_ebs_volume"},
+		check: func(r ruleResource) (bool, []string) {
+			return ruleEnabled(r.body, "encrypted", r.ctx), []string{"encrypted"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_4",
+		name:          "Ensure the block devices of EC2 instances are encrypted",
+		resourceTypes: []string{"aws_instance", "aws_launch_template"},
+		check: func(r ruleResource) (bool, []string) {
+			var devices []*hclsyntax.Body
+			devices = append(devices, ruleBlocks(r.body, "root_block_device")...)
+			devices = append(devices, ruleBlocks(r.body, "ebs_block_device")...)
+			for _, mapping := range ruleBlocks(r.body, "block_device_mappings") {
+				devices = append(devices, ruleBlocks(mapping, "ebs")...)
+			}
+			for _, device := range devices {
+				if !ruleEnabled(device, "encrypted", r.ctx) {
+					return false, []string{"root_block_device/encrypted", "ebs_block_device/encrypted", "block_device_mappings/ebs/encrypted"}
+				}
+			}
+			return true, []string{"root_block_device/encrypted", "ebs_block_device/encrypted", "block_device_mappings/ebs/encrypted"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_5",
+		name:          "Ensure RDS storage is encrypted",
+		resourceTypes: []string{"aws_db_instance", "aws_rds_cluster"},
+		check: func(r ruleResource) (bool, []string) {
+			return ruleEnabled(r.body, "storage_encrypted", r.ctx), []string{"storage_encrypted"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_6",
+		name:          "Ensure no security group allows ingress from 0.0.0.0/0 to SSH or RDP",
+		resourceTypes: []string{"aws_security_group", "aws_security_group_rule", "aws_vpc_security_group_ingress_rule"},
+		check: func(r ruleResource) (bool, []string) {
+			switch r.typeName {
+			case "aws_security_group":
+				for _, ingress := range ruleBlocks(r.body, "ingress") {
+					if awsIngressOpen(ingress, r.ctx, "cidr_blocks", "ipv6_cidr_blocks", "protocol") {
+						return false, []string{"ingress/cidr_blocks", "ingress/ipv6_cidr_blocks", "ingress/from_port", "ingress/to_port"}
+					}
+				}
+				return true, []string{"ingress/cidr_blocks", "ingress/ipv6_cidr_blocks", "ingress/from_port", "ingress/to_port"}
+			case "aws_security_group_rule":
+				if ruleType, known := ruleString(r.body, "type", r.ctx); !known || ruleType != "ingress" {
+					return true, []string{"type"}
+				}
+				return !awsIngressOpen(r.body, r.ctx, "cidr_blocks", "ipv6_cidr_blocks", "protocol"), []string{"type", "cidr_blocks", "ipv6_cidr_blocks", "from_port", "to_port"}
+			default:
+				return !awsIngressOpen(r.body, r.ctx, "cidr_ipv4", "cidr_ipv6", "ip_protocol"), []string{"cidr_ipv4", "cidr_ipv6", "from_port", "to_port"}
+			}
+		},
+	},
+	{
+		id:            "MAZE_AWS_7",
+		name:          "Ensure S3 buckets have access logging enabled",
+		resourceTypes: []string{"aws_s3_bucket"},
+		check: func(r ruleResource) (bool, []string) {
+			if len(ruleBlocks(r.body, "logging")) > 0 {
+				return true, []string{"logging"}
+			}
+			return r.referencedBy("aws_s3_bucket_logging", "bucket"), []string{"logging"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_8",
+		name:          "Ensure VPCs have flow logs enabled",
+		resourceTypes: []string{"aws_vpc"},
+		check: func(r ruleResource) (bool, []string) {
+			return r.referencedBy("aws_flow_log", "vpc_id"), []string{"aws_flow_log/vpc_id"}
+		},
+	},
+	{
+		id:            "MAZE_AWS_9",
+		name:          "Ensure the default VPC and its subnets are not used",
+		resourceTypes: []string{"aws_default_vpc", "aws_default_subnet"},
+		check: func(r ruleResource) (bool, []string) {
+			return false, []string{}
+		},
+	},
+	{
+		id:            "MAZE_AZURE_1",
+		name:          "Ensure storage accounts do not allow public access to blobs",
+		resourceTypes: []string{"azurerm_storage_account"},
+		check: func(r ruleResource) (bool, []string) {
+			// The attribute was renamed in version 3 of the provider and
+			// defaults to allowing public access.
+			for _, key := range []string{"allow_nested_items_to_be_public", "allow_blob_public_access"} {
+				if _, exists := r.body.Attributes[key]; exists {
+					return !ruleEnabled(r.body, key, r.ctx) || !ruleKnown(r.body, key, r.ctx), []string{key}
+				}
+			}
+			return false, []string{"allow_nested_items_to_be_public"}
+		},
+	},
+	{
+		id:            "MAZE_AZURE_2",
+		name:          "Ensure storage containers are private",
+		resourceTypes: []string{"azurerm_storage_container"},
+		check: func(r ruleResource) (bool, []string) {
+			accessType, known := ruleString(r.body, "container_access_type", r.ctx)
+			return !known || accessType == "private", []string{"container_access_type"}
+		},
+	},
+	{
+		id:            "MAZE_AZURE_3",
+		name:          "Ensure managed disks do not disable encryption",
+		resourceTypes: []string{"azurerm_managed_disk"},
+		check: func(r ruleResource) (bool, []string) {
+			for _, settings := range ruleBlocks(r.body, "encryption_settings") {
+				if enabled, known := ruleBool(settings, "enabled", r.ctx); known && !enabled {
+					return false, []string{"encryption_settings/enabled"}
+				}
+			}
+			return true, []string{"encryption_settings/enabled"}
+		},
+	},
+	{
+		id:            "MAZE_AZURE_4",
+		name:          "Ensure no network security group allows inbound SSH or RDP from the internet",
+		resourceTypes: []string{"azurerm_network_security_group", "azurerm_network_security_rule"},
+		check: func(r ruleResource) (bool, []string) {
+			rules := []*hclsyntax.Body{r.body}
+			if r.typeName == "azurerm_network_security_group" {
+				rules = ruleBlocks(r.body, "security_rule")
+			}
+			keys := []string{"direction", "access", "source_address_prefix", "source_address_prefixes", "destination_port_range", "destination_port_ranges"}
+			for _, rule := range rules {
+				if azureRuleOpen(rule, r.ctx) {
+					return false, keys
+				}
+			}
+			return true, keys
+		},
+	},
+	{
+		id:            "MAZE_AZURE_5",
+		name:          "Ensure network security groups have flow logs enabled",
+		resourceTypes: []string{"azurerm_network_security_group"},
+		check: func(r ruleResource) (bool, []string) {
+			return r.referencedBy("azurerm_network_watcher_flow_log", "network_security_group_id"), []string{"azurerm_network_watcher_flow_log/network_security_group_id"}
+		},
+	},
+	{
+		id:            "MAZE_GCP_1",
+		name:          "Ensure storage buckets are not readable by allUsers or allAuthenticatedUsers",
+		resourceTypes: []string{"google_storage_bucket_iam_member", "google_storage_bucket_iam_binding", "google_storage_bucket_access_control", "google_storage_default_object_access_control"},
+		check: func(r ruleResource) (bool, []string) {
+			for _, key := range []string{"member", "members", "entity"} {
+				members, _ := ruleStrings(r.body, key, r.ctx)
+				for _, member := range members {
+					if member == "allUsers" || member == "allAuthenticatedUsers" {
+						return false, []string{key}
+					}
+				}
+			}
+			return true, []string{"member", "members", "entity"}
+		},
+	},
+	{
+		id:            "MAZE_GCP_2",
+		name:          "Ensure storage buckets have access logging enabled",
+		resourceTypes: []string{"google_storage_bucket"},
+		check: func(r ruleResource) (bool, []string) {
+			return len(ruleBlocks(r.body, "logging")) > 0, []string{"logging"}
+		},
+	},
+	{
+		id:            "MAZE_GCP_3",
+		name:          "Ensure no firewall rule allows ingress from 0.0.0.0/0 to SSH or RDP",
+		resourceTypes: []string{"google_compute_firewall"},
+		check: func(r ruleResource) (bool, []string) {
+			keys := []string{"direction", "source_ranges", "allow/protocol", "allow/ports"}
+			if direction, known := ruleString(r.body, "direction", r.ctx); known && direction != "INGRESS" {
+				return true, keys
+			}
+			sourceRanges, _ := ruleStrings(r.body, "source_ranges", r.ctx)
+			if !containsOpenRange(sourceRanges) {
+				return true, keys
+			}
+			for _, allow := range ruleBlocks(r.body, "allow") {
+				protocol, known := ruleString(allow, "protocol", r.ctx)
+				if !known || (protocol != "tcp" && protocol != "all") {
+					continue
+				}
+				if _, exists := allow.Attributes["ports"]; !exists {
+					return false, keys
+				}
+				ports, _ := ruleStrings(allow, "ports", r.ctx)
+				for _, portRange := range ports {
+					if rangeHasAdminPort(portRange) {
+						return false, keys
+					}
+				}
+			}
+			return true, keys
+		},
+	},
+	{
+		id:            "MAZE_GCP_4",
+		name:          "Ensure subnetworks have VPC flow logs enabled",
+		resourceTypes: []string{"google_compute_subnetwork"},
+		check: func(r ruleResource) (bool, []string) {
+			return len(ruleBlocks(r.body, "log_config")) > 0, []string{"log_config"}
+		},
+	},
+	{
+		id:            "MAZE_GCP_5",
+		name:          "Ensure the default network is not used",
+		resourceTypes: []string{"google_compute_instance", "google_compute_instance_template", "google_compute_firewall"},
+		check: func(r ruleResource) (bool, []string) {
+			if r.typeName == "google_compute_firewall" {
+				network, known := ruleString(r.body, "network", r.ctx)
+				return !known || !isDefaultNetwork(network), []string{"network"}
+			}
+			for _, networkInterface := range ruleBlocks(r.body, "network_interface") {
+				network, known := ruleString(networkInterface, "network", r.ctx)
+				_, hasSubnetwork := networkInterface.Attributes["subnetwork"]
+				if known && isDefaultNetwork(network) && !hasSubnetwork {
+					return false, []string{"network_interface/network"}
+				}
+			}
+			return true, []string{"network_interface/network"}
+		},
+	},
+}
+
+// rulesFor returns the rules that apply to a resource type.
+func rulesFor(typeName string) (rules []complianceRule) {
+	for _, rule := range complianceRules {
+		for _, resourceType := range rule.resourceTypes {
+			if resourceType == typeName {
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// referencedBy reports whether a resource of another type in the same module
+// refers to this one in the given attribute.
+func (r ruleResource) referencedBy(typeName string, attributeName string) bool {
+	for _, other := range r.module {
+		if other.typeName != typeName {
+			continue
+		}
+		attr, exists := other.body.Attributes[attributeName]
+		if !exists {
+			continue
+		}
+		for _, traversal := range attr.Expr.Variables() {
+			if traversal.RootName() != r.typeName || len(traversal) < 2 {
+				continue
+			}
+			if step, ok := traversal[1].(hcl.TraverseAttr); ok && step.Name == r.name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ruleValue evaluates an attribute, reporting false when it is missing or
+// only known after apply.
+func ruleValue(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (cty.Value, bool) {
+	attr, exists := body.Attributes[name]
+	if !exists {
+		return cty.NilVal, false
+	}
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// ruleKnown reports whether an attribute is missing or has a known value.
+func ruleKnown(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) bool {
+	if _, exists := body.Attributes[name]; !exists {
+		return true
+	}
+	_, known := ruleValue(body, name, ctx)
+	return known
+}
+
+func ruleString(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (string, bool) {
+	value, known := ruleValue(body, name, ctx)
+	if !known {
+		return "", false
+	}
+	switch value.Type() {
+	case cty.String:
+		return value.AsString(), true
+	case cty.Number:
+		return value.AsBigFloat().Text('f', -1), true
+	}
+	return "", false
+}
+
+func ruleBool(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (bool, bool) {
+	value, known := ruleValue(body, name, ctx)
+	if !known {
+		return false, false
+	}
+	switch value.Type() {
+	case cty.Bool:
+		return value.True(), true
+	case cty.String:
+		enabled, err := strconv.ParseBool(value.AsString())
+		return enabled, err == nil
+	}
+	return false, false
+}
+
+// ruleEnabled reports whether a setting that defaults to false is turned on,
+// giving the benefit of the doubt to values only known after apply.
+func ruleEnabled(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) bool {
+	if _, exists := body.Attributes[name]; !exists {
+		return false
+	}
+	enabled, known := ruleBool(body, name, ctx)
+	return enabled || !known
+}
+
+// ruleStrings returns the strings of a list or set attribute, or a single
+// string attribute as a list.
+func ruleStrings(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (values []string, known bool) {
+	value, known := ruleValue(body, name, ctx)
+	if !known {
+		return nil, false
+	}
+	if value.Type() == cty.String {
+		return []string{value.AsString()}, true
+	}
+	if !value.CanIterateElements() {
+		return nil, false
+	}
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.Type() == cty.String {
+			values = append(values, element.AsString())
+		} else if element.Type() == cty.Number {
+			values = append(values, element.AsBigFloat().Text('f', -1))
+		}
+	}
+	return values, true
+}
+
+func ruleNumber(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (int64, bool) {
+	value, known := ruleValue(body, name, ctx)
+	if !known || value.Type() != cty.Number {
+		return 0, false
+	}
+	number, accuracy := value.AsBigFloat().Int64()
+	return number, accuracy == big.Exact
+}
+
+// ruleBlocks returns the bodies of the nested blocks of a type.
+func ruleBlocks(body *hclsyntax.Body, typeName string) (bodies []*hclsyntax.Body) {
+	for _, block := range body.Blocks {
+		if block.Type == typeName {
+			bodies = append(bodies, block.Body)
+		}
+	}
+	return bodies
+}
+
+func containsOpenRange(ranges []string) bool {
+	for _, cidr := range ranges {
+		if cidr == "0.0.0.0/0" || cidr == "::/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// awsIngressOpen reports whether an AWS ingress rule lets anyone reach an
+// admin port.
+func awsIngressOpen(body *hclsyntax.Body, ctx *hcl.EvalContext, ipv4Key string, ipv6Key string, protocolKey string) bool {
+	ipv4, _ := ruleStrings(body, ipv4Key, ctx)
+	ipv6, _ := ruleStrings(body, ipv6Key, ctx)
+	if !containsOpenRange(append(ipv4, ipv6...)) {
+		return false
+	}
+	if protocol, known := ruleString(body, protocolKey, ctx); known && (protocol == "-1" || protocol == "all") {
+		return true
+	}
+	fromPort, fromKnown := ruleNumber(body, "from_port", ctx)
+	toPort, toKnown := ruleNumber(body, "to_port", ctx)
+	if !fromKnown || !toKnown {
+		return false
+	}
+	for _, port := range adminPorts {
+		if fromPort <= port && port <= toPort {
+			return true
+		}
+	}
+	return false
+}
+
+// azureRuleOpen reports whether an Azure security rule allows inbound
+// traffic from the internet to an admin port.
+func azureRuleOpen(body *hclsyntax.Body, ctx *hcl.EvalContext) bool {
+	direction, directionKnown := ruleString(body, "direction", ctx)
+	access, accessKnown := ruleString(body, "access", ctx)
+	if !directionKnown || !accessKnown || !strings.EqualFold(direction, "Inbound") || !strings.EqualFold(access, "Allow") {
+		return false
+	}
+	sources, _ := ruleStrings(body, "source_address_prefix", ctx)
+	moreSources, _ := ruleStrings(body, "source_address_prefixes", ctx)
+	open := false
+	for _, source := range append(sources, moreSources...) {
+		switch strings.ToLower(source) {
+		case "*", "0.0.0.0", "0.0.0.0/0", "::/0", "internet", "any":
+			open = true
+		}
+	}
+	if !open {
+		return false
+	}
+	ports, _ := ruleStrings(body, "destination_port_range", ctx)
+	morePorts, _ := ruleStrings(body, "destination_port_ranges", ctx)
+	for _, portRange := range append(ports, morePorts...) {
+		if rangeHasAdminPort(portRange) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeHasAdminPort reports whether a port, a range such as 20-30, or * for
+// every port includes an admin port.
+func rangeHasAdminPort(portRange string) bool {
+	portRange = strings.TrimSpace(portRange)
+	if portRange == "*" {
+		return true
+	}
+	from, to, isRange := strings.Cut(portRange, "-")
+	if !isRange {
+		to = from
+	}
+	fromPort, err := strconv.ParseInt(strings.TrimSpace(from), 10, 64)
+	if err != nil {
+		return false
+	}
+	toPort, err := strconv.ParseInt(strings.TrimSpace(to), 10, 64)
+	if err != nil {
+		return false
+	}
+	for _, port := range adminPorts {
+		if fromPort <= port && port <= toPort {
+			return true
+		}
+	}
+	return false
+}
+
+func isDefaultNetwork(network string) bool {
+	return network == "default" || strings.HasSuffix(network, "/networks/default")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRangeHasAdminPort(t *testing.T) {
+	tests := []struct {
+		portRange string
+		want      bool
+	}{
+		{"22", true},
+		{"3389", true},
+		{"*", true},
+		{" 20-30 ", true},
+		{"3000-4000", true},
+		{"80", false},
+		{"23-3388", false},
+		{"443-443", false},
+		{"", false},
+		{"ssh", false},
+		{"22-", false},
+	}
+	for _, test := range tests {
+		if got := rangeHasAdminPort(test.portRange); got != test.want {
+			t.Errorf("rangeHasAdminPort(%q) = %v, want %v", test.portRange, got, test.want)
+		}
+	}
+}
+
+func TestAwsIngressOpen(t *testing.T) {
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"open":    cty.StringVal("0.0.0.0/0"),
+			"office":  cty.StringVal("10.0.0.0/8"),
+			"unknown": cty.UnknownVal(cty.String),
+		}),
+	}}
+	tests := []struct {
+		name string
+		rule string
+		want bool
+	}{
+		{"ssh from anywhere", `from_port = 22
+to_port = 22
+protocol = "tcp"
+cidr_blocks = ["0.0.0.0/0"]`, true},
+		{"rdp in a range", `from_port = 3000
+to_port = 4000
+protocol = "tcp"
+cidr_blocks = ["0.0.0.0/0"]`, true},
+		{"ipv6 anywhere", `from_port = 22
+to_port = 22
+protocol = "tcp"
+ipv6_cidr_blocks = ["::/0"]`, true},
+		{"all protocols", `from_port = 0
+to_port = 0
+protocol = "-1"
+cidr_blocks = [var.open]`, true},
+		{"https from anywhere", `from_port = 443
+to_port = 443
+protocol = "tcp"
+cidr_blocks = ["0.0.0.0/0"]`, false},
+		{"ssh from the office", `from_port = 22
+to_port = 22
+protocol = "tcp"
+cidr_blocks = [var.office]`, false},
+		{"source known after apply", `from_port = 22
+to_port = 22
+protocol = "tcp"
+cidr_blocks = [var.unknown]`, false},
+		{"ports known after apply", `from_port = var.unknown
+to_port = 22
+protocol = "tcp"
+cidr_blocks = ["0.0.0.0/0"]`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, diags := hclsyntax.ParseConfig([]byte(test.rule), "rule.tf", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+			body := file.Body.(*hclsyntax.Body)
+			if got := awsIngressOpen(body, ctx, "cidr_blocks", "ipv6_cidr_blocks", "protocol"); got != test.want {
+				t.Errorf("awsIngressOpen = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
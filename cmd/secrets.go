@@ -0,0 +1,109 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var allowSecrets bool
+
+// A pattern that identifies a kind of hard-coded credential.
+type secretRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{"AWS secret access key", regexp.MustCompile(`(?i)(?:aws_?secret_?(?:access_?)?key|secret_key)\s*[=:]\s*"[A-Za-z0-9/+=]{40}"`)},
+	{"Azure storage account key", regexp.MustCompile(`(?i)(?:AccountKey=[A-Za-z0-9+/]{86}==|(?:storage_account_key|primary_access_key|secondary_access_key|access_key)\s*[=:]\s*"[A-Za-z0-9+/]{86}==")`)},
+	{"GCP service account key", regexp.MustCompile(`"type"\s*:\s*"service_account"|"private_key_id"\s*:\s*"[0-9a-f]{40}"`)},
+	{"Private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+}
+
+// Matches `name = "value"` assignments for the entropy check.
+var secretAssignment = regexp.MustCompile(`(?i)^\s*"?([a-z0-9_\-]*(?:password|passwd|secret|token|api_?key|access_?key|credential|private_?key)[a-z0-9_\-]*)"?\s*[=:]\s*"([^"]*)"`)
+
+// A credential found in a file.
+type secretFinding struct {
+	relativePath string
+	line         int
+	rule         string
+}
+
+// scanSecrets looks for hard-coded credentials in the configuration, tfvars
+// and terragrunt files that are about to be uploaded.
+func scanSecrets(collection fileCollection) (findings []secretFinding, err error) {
+	for _, file := range collection.files {
+		if !isConfigFile(file.path) && !isVariablesFile(file.path) && !isTerragruntFile(file.path) {
+			continue
+		}
+		fileFindings, err := scanFile(file)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, fileFindings...)
+	}
+	return findings, nil
+}
+
+func scanFile(file collectedFile) (findings []secretFinding, err error) {
+	fileToScan, err := file.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", file.path, err)
+	}
+	defer fileToScan.Close()
+
+	scanner := bufio.NewScanner(fileToScan)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		matched := false
+		for _, rule := range secretRules {
+			if rule.re.MatchString(text) {
+				findings = append(findings, secretFinding{file.relativePath, line, rule.name})
+				matched = true
+			}
+		}
+		// The entropy check only reports lines no specific rule explained.
+		if match := secretAssignment.FindStringSubmatch(text); !matched && match != nil && looksRandom(match[2]) {
+			findings = append(findings, secretFinding{file.relativePath, line, "High entropy value in " + match[1]})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", file.path, err)
+	}
+	return findings, nil
+}
+
+// looksRandom reports whether a value is long and random enough to be a
+// credential rather than a name, reference or placeholder.
+func looksRandom(value string) bool {
+	if len(value) < 16 || value == redactedValue || strings.Contains(value, "${") {
+		return false
+	}
+	return shannonEntropy(value) >= 3.5
+}
+
+// shannonEntropy returns the average number of bits per character.
+func shannonEntropy(value string) float64 {
+	counts := map[rune]int{}
+	for _, r := range value {
+		counts[r]++
+	}
+	entropy := 0.0
+	length := float64(len([]rune(value)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
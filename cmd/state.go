@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Where the project a terraform directory was planned into is remembered,
+// relative to --dir. It is meant to be committed so every run of the
+// repository updates the same project.
+var stateFilePath = filepath.Join(".maze", "state")
+
+var (
+	description string
+	tags        []string
+	newProject  bool
+)
+
+// The projects a terraform directory was planned into, by server url.
+type projectState struct {
+	Projects map[string]stateEntry `json:"projects"`
+}
+
+type stateEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func statePath() string {
+	return filepath.Join(dirPath, stateFilePath)
+}
+
+// loadState reads the state file, which may not exist yet.
+func loadState() (state projectState, err error) {
+	data, err := os.ReadFile(statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return projectState{Projects: map[string]stateEntry{}}, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("could not parse %s: %w", statePath(), err)
+	}
+	if state.Projects == nil {
+		state.Projects = map[string]stateEntry{}
+	}
+	return state, nil
+}
+
+// rememberedProject returns the project this directory was last planned into
+// on the current server under the current name, if any.
+func rememberedProject() string {
+	state, err := loadState()
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	if entry, exists := state.Projects[url]; exists && entry.Name == name {
+		return entry.ID
+	}
+	return ""
+}
+
+// rememberProject records the project this directory was planned into.
+func rememberProject(id string) error {
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	state.Projects[url] = stateEntry{ID: id, Name: name, UpdatedAt: time.Now().UTC()}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath()), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(), append(data, '\n'), 0644)
+}
+
+// parseTags reads --tag values given as key=value.
+func parseTags(values []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, value := range values {
+		key, tagValue, found := strings.Cut(value, "=")
+		if key = strings.TrimSpace(key); !found || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, use key=value", value)
+		}
+		parsed[key] = tagValue
+	}
+	return parsed, nil
+}
+
+// tagValues turns tags from .maze.yaml into key=value flag values.
+func tagValues(tags map[string]string) (values []string) {
+	for key, value := range tags {
+		values = append(values, key+"="+value)
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,504 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+const (
+	terragruntConfigName = "terragrunt.hcl"
+	// tfvars generated from a unit's inputs, next to its terragrunt.hcl.
+	terragruntVarsName = "terragrunt.auto.tfvars"
+)
+
+// The kind of infrastructure code being uploaded.
+var iacMode string
+
+// A terragrunt unit, a directory whose terragrunt.hcl deploys one module.
+type terragruntUnit struct {
+	dir string
+	// Configuration files pulled in with include blocks.
+	includes []string
+	// terraform.source, when it could be evaluated.
+	source string
+	// Directories of the units named by dependency and dependencies blocks,
+	// which terragrunt applies first.
+	dependencies []string
+	inputs       map[string]cty.Value
+	// Inputs that could not be evaluated locally, such as dependency
+	// outputs without mock_outputs.
+	skippedInputs []string
+}
+
+// The parts of a terragrunt configuration file the cli understands.
+type terragruntConfig struct {
+	includes     []string
+	source       string
+	dependencies []string
+	inputs       map[string]cty.Value
+	skipped      []string
+}
+
+// detectIaC works out whether the collected files are terragrunt, OpenTofu or
+// plain terraform, unless --iac was given.
+func detectIaC(files []collectedFile) string {
+	if iacMode != "auto" {
+		return iacMode
+	}
+	detected := "terraform"
+	for _, file := range files {
+		if filepath.Base(file.path) == terragruntConfigName {
+			return "terragrunt"
+		}
+		if ext := filepath.Ext(file.path); ext == ".tofu" || ext == ".tofuvars" {
+			detected = "opentofu"
+		}
+	}
+	return detected
+}
+
+// readTerragruntUnits evaluates every terragrunt.hcl among the collected
+// files. Configuration files that are only included by others are not units.
+func readTerragruntUnits(files []collectedFile) (units []terragruntUnit, err error) {
+	included := map[string]bool{}
+	for _, file := range files {
+		if filepath.Base(file.path) != terragruntConfigName {
+			continue
+		}
+		unitDir := filepath.Dir(file.path)
+		config, err := readTerragruntConfig(file.path, unitDir, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		for _, include := range config.includes {
+			included[include] = true
+		}
+		units = append(units, terragruntUnit{
+			dir:           unitDir,
+			includes:      config.includes,
+			source:        config.source,
+			dependencies:  config.dependencies,
+			inputs:        config.inputs,
+			skippedInputs: config.skipped,
+		})
+	}
+
+	var filtered []terragruntUnit
+	for _, unit := range units {
+		if !included[filepath.Join(unit.dir, terragruntConfigName)] {
+			unit.dependencies = uniqueSorted(unit.dependencies)
+			filtered = append(filtered, unit)
+		}
+	}
+	return orderUnits(filtered), nil
+}
+
+// orderUnits sorts units so that every unit comes after the units it depends
+// on, the order terragrunt applies them in. Units in a dependency cycle keep
+// their order at the end.
+func orderUnits(units []terragruntUnit) []terragruntUnit {
+	pending := map[string]bool{}
+	for _, unit := range units {
+		pending[unit.dir] = true
+	}
+	ordered := make([]terragruntUnit, 0, len(units))
+	for len(ordered) < len(units) {
+		progress := false
+		for _, unit := range units {
+			if !pending[unit.dir] {
+				continue
+			}
+			ready := true
+			for _, dependency := range unit.dependencies {
+				if pending[dependency] && dependency != unit.dir {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, unit)
+				delete(pending, unit.dir)
+				progress = true
+			}
+		}
+		if !progress {
+			for _, unit := range units {
+				if pending[unit.dir] {
+					ordered = append(ordered, unit)
+				}
+			}
+			break
+		}
+	}
+	return ordered
+}
+
+// readTerragruntConfig evaluates a terragrunt configuration file and the
+// files it includes. unitDir is the directory of the unit being evaluated,
+// which terragrunt functions resolve against even inside included files.
+func readTerragruntConfig(path string, unitDir string, seen map[string]bool) (config terragruntConfig, err error) {
+	if seen[path] {
+		return config, fmt.Errorf("%s includes itself", path)
+	}
+	seen[path] = true
+
+	body, err := parseHCLFile(path)
+	if err != nil {
+		return config, err
+	}
+	ctx := terragruntEvalContext(unitDir, filepath.Dir(path))
+	ctx.Variables["local"] = evaluateLocals(ctx, body)
+
+	config.inputs = map[string]cty.Value{}
+	dependencies := map[string]cty.Value{}
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "include":
+			includePath, ok := evaluateString(block.Body, "path", ctx)
+			if !ok {
+				continue
+			}
+			if !filepath.IsAbs(includePath) {
+				includePath = filepath.Join(filepath.Dir(path), includePath)
+			}
+			parent, err := readTerragruntConfig(includePath, unitDir, seen)
+			if err != nil {
+				return config, err
+			}
+			// The including file wins over what it includes.
+			config.includes = append(config.includes, includePath)
+			config.includes = append(config.includes, parent.includes...)
+			config.dependencies = append(config.dependencies, parent.dependencies...)
+			config.skipped = append(config.skipped, parent.skipped...)
+			if config.source == "" {
+				config.source = parent.source
+			}
+			for name, value := range parent.inputs {
+				if _, exists := config.inputs[name]; !exists {
+					config.inputs[name] = value
+				}
+			}
+		case "dependency":
+			if len(block.Labels) != 1 {
+				continue
+			}
+			if configPath, ok := evaluateString(block.Body, "config_path", ctx); ok {
+				if !filepath.IsAbs(configPath) {
+					configPath = filepath.Join(filepath.Dir(path), configPath)
+				}
+				config.dependencies = append(config.dependencies, filepath.Clean(configPath))
+			}
+			// Outputs of other units are only known after they are applied,
+			// so mock_outputs stand in for them where given.
+			outputs := cty.DynamicVal
+			if attr, exists := block.Body.Attributes["mock_outputs"]; exists {
+				if value, diags := attr.Expr.Value(ctx); !diags.HasErrors() {
+					outputs = value
+				}
+			}
+			dependencies[block.Labels[0]] = cty.ObjectVal(map[string]cty.Value{"outputs": outputs})
+		case "dependencies":
+			attr, exists := block.Body.Attributes["paths"]
+			if !exists {
+				continue
+			}
+			paths, diags := attr.Expr.Value(ctx)
+			if diags.HasErrors() || !paths.IsWhollyKnown() || !paths.CanIterateElements() {
+				continue
+			}
+			for _, element := range paths.AsValueSlice() {
+				if element.Type() != cty.String {
+					continue
+				}
+				dependencyPath := element.AsString()
+				if !filepath.IsAbs(dependencyPath) {
+					dependencyPath = filepath.Join(filepath.Dir(path), dependencyPath)
+				}
+				config.dependencies = append(config.dependencies, filepath.Clean(dependencyPath))
+			}
+		}
+	}
+	ctx.Variables["dependency"] = cty.ObjectVal(dependencies)
+
+	for _, block := range body.Blocks {
+		if block.Type == "terraform" {
+			if source, ok := evaluateString(block.Body, "source", ctx); ok {
+				config.source = source
+			}
+		}
+	}
+
+	if attr, exists := body.Attributes["inputs"]; exists {
+		inputs, skipped := evaluateInputs(attr.Expr, ctx)
+		for name, value := range inputs {
+			config.inputs[name] = value
+		}
+		config.skipped = append(config.skipped, skipped...)
+	}
+	return config, nil
+}
+
+// evaluateInputs evaluates each input on its own so one unknown value does
+// not lose all the others.
+func evaluateInputs(expr hclsyntax.Expression, ctx *hcl.EvalContext) (inputs map[string]cty.Value, skipped []string) {
+	inputs = map[string]cty.Value{}
+	object, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		value, diags := expr.Value(ctx)
+		if diags.HasErrors() || !value.IsWhollyKnown() || !value.CanIterateElements() {
+			return inputs, []string{"inputs"}
+		}
+		for name, element := range value.AsValueMap() {
+			inputs[name] = element
+		}
+		return inputs, nil
+	}
+
+	for _, item := range object.Items {
+		name := hcl.ExprAsKeyword(item.KeyExpr)
+		if name == "" {
+			key, diags := item.KeyExpr.Value(ctx)
+			if diags.HasErrors() || key.Type() != cty.String {
+				continue
+			}
+			name = key.AsString()
+		}
+		value, diags := item.ValueExpr.Value(ctx)
+		if diags.HasErrors() || !value.IsWhollyKnown() {
+			skipped = append(skipped, name)
+			continue
+		}
+		inputs[name] = value
+	}
+	return inputs, skipped
+}
+
+// evaluateLocals evaluates the locals blocks of one or more files. Locals may
+// refer to each other, so evaluation repeats until no more of them can be
+// resolved.
+func evaluateLocals(ctx *hcl.EvalContext, bodies ...*hclsyntax.Body) cty.Value {
+	locals := map[string]cty.Value{}
+	pending := map[string]*hclsyntax.Attribute{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type == "locals" {
+				for name, attr := range block.Body.Attributes {
+					pending[name] = attr
+				}
+			}
+		}
+	}
+
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		ctx.Variables["local"] = cty.ObjectVal(locals)
+		for name, attr := range pending {
+			if value, diags := attr.Expr.Value(ctx); !diags.HasErrors() {
+				locals[name] = value
+				delete(pending, name)
+				progress = true
+			}
+		}
+	}
+	return cty.ObjectVal(locals)
+}
+
+func evaluateString(body *hclsyntax.Body, name string, ctx *hcl.EvalContext) (string, bool) {
+	attr, exists := body.Attributes[name]
+	if !exists {
+		return "", false
+	}
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// terragruntEvalContext provides the terragrunt functions most often used in
+// include paths, sources and inputs, together with common terraform ones.
+func terragruntEvalContext(unitDir string, configDir string) *hcl.EvalContext {
+	stringFunc := func(impl func(args []cty.Value) (string, error)) function.Function {
+		return function.New(&function.Spec{
+			VarParam: &function.Parameter{Name: "args", Type: cty.String},
+			Type:     function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				result, err := impl(args)
+				if err != nil {
+					return cty.NilVal, err
+				}
+				return cty.StringVal(result), nil
+			},
+		})
+	}
+	argOr := func(args []cty.Value, i int, fallback string) string {
+		if len(args) > i {
+			return args[i].AsString()
+		}
+		return fallback
+	}
+
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{},
+		Functions: map[string]function.Function{
+			"find_in_parent_folders": stringFunc(func(args []cty.Value) (string, error) {
+				fileName := argOr(args, 0, terragruntConfigName)
+				for dir := filepath.Dir(unitDir); ; dir = filepath.Dir(dir) {
+					candidate := filepath.Join(dir, fileName)
+					if _, err := os.Stat(candidate); err == nil {
+						return candidate, nil
+					}
+					if filepath.Dir(dir) == dir {
+						break
+					}
+				}
+				if len(args) > 1 {
+					return args[1].AsString(), nil
+				}
+				return "", fmt.Errorf("could not find %s in a parent folder of %s", fileName, unitDir)
+			}),
+			"get_terragrunt_dir": stringFunc(func(args []cty.Value) (string, error) {
+				return unitDir, nil
+			}),
+			"get_parent_terragrunt_dir": stringFunc(func(args []cty.Value) (string, error) {
+				return configDir, nil
+			}),
+			"path_relative_to_include": stringFunc(func(args []cty.Value) (string, error) {
+				return filepath.Rel(configDir, unitDir)
+			}),
+			"path_relative_from_include": stringFunc(func(args []cty.Value) (string, error) {
+				return filepath.Rel(unitDir, configDir)
+			}),
+			"get_repo_root": stringFunc(func(args []cty.Value) (string, error) {
+				for dir := unitDir; ; dir = filepath.Dir(dir) {
+					if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+						return dir, nil
+					}
+					if filepath.Dir(dir) == dir {
+						return "", errors.New("not inside a git repository")
+					}
+				}
+			}),
+			"get_env": stringFunc(func(args []cty.Value) (string, error) {
+				if len(args) == 0 {
+					return "", errors.New("get_env needs the name of a variable")
+				}
+				if value, ok := os.LookupEnv(args[0].AsString()); ok {
+					return value, nil
+				}
+				if len(args) > 1 {
+					return args[1].AsString(), nil
+				}
+				return "", fmt.Errorf("environment variable %s is not set", args[0].AsString())
+			}),
+			"concat":     stdlib.ConcatFunc,
+			"format":     stdlib.FormatFunc,
+			"join":       stdlib.JoinFunc,
+			"jsonencode": stdlib.JSONEncodeFunc,
+			"lookup":     stdlib.LookupFunc,
+			"lower":      stdlib.LowerFunc,
+			"merge":      stdlib.MergeFunc,
+			"split":      stdlib.SplitFunc,
+			"trimspace":  stdlib.TrimSpaceFunc,
+			"upper":      stdlib.UpperFunc,
+		},
+	}
+}
+
+// localSourceDir returns the directory of a terraform.source that points at
+// a module on disk, following terragrunt's "//" subdirectory notation.
+func localSourceDir(unit terragruntUnit) (string, bool) {
+	source := unit.source
+	if source == "" || strings.Contains(source, "::") || strings.Contains(source, "://") {
+		return "", false
+	}
+	if !filepath.IsAbs(source) && !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return "", false
+	}
+	source = strings.Replace(source, "//", "/", 1)
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(unit.dir, filepath.FromSlash(source))
+	}
+	return source, true
+}
+
+// terragruntVarsFile renders a unit's inputs as a tfvars file so the server
+// sees the values terragrunt would pass to terraform.
+func terragruntVarsFile(unit terragruntUnit) (file collectedFile, ok bool) {
+	if len(unit.inputs) == 0 {
+		return file, false
+	}
+	names := make([]string, 0, len(unit.inputs))
+	for name := range unit.inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	varsFile := hclwrite.NewEmptyFile()
+	for _, name := range names {
+		varsFile.Body().SetAttributeValue(name, unit.inputs[name])
+	}
+	content := varsFile.Bytes()
+	return collectedFile{
+		path:    filepath.Join(unit.dir, terragruntVarsName),
+		size:    int64(len(content)),
+		content: content,
+	}, true
+}
+
+// readTerragrunt evaluates the terragrunt units among the collected files. It
+// returns the files the units need beyond them: included configuration from
+// parent folders, local module sources outside root and the generated tfvars.
+func readTerragrunt(root string, files []collectedFile) (extraFiles []collectedFile, units []terragruntUnit, moduleDirs []string, err error) {
+	units, err = readTerragruntUnits(files)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		seen[file.path] = true
+	}
+	for _, unit := range units {
+		for _, include := range unit.includes {
+			if seen[include] {
+				continue
+			}
+			seen[include] = true
+			info, err := os.Stat(include)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read %s included from %s: %v", include, unit.dir, err)
+			}
+			extraFiles = append(extraFiles, collectedFile{path: include, size: info.Size()})
+		}
+
+		if moduleDir, ok := localSourceDir(unit); ok && !isWithin(root, moduleDir) && !seen[moduleDir] {
+			seen[moduleDir] = true
+			moduleFiles, err := readModuleDir(moduleDir)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read module %s used by %s: %v", unit.source, unit.dir, err)
+			}
+			extraFiles = append(extraFiles, moduleFiles...)
+			moduleDirs = append(moduleDirs, moduleDir)
+		}
+
+		if varsFile, ok := terragruntVarsFile(unit); ok {
+			extraFiles = append(extraFiles, varsFile)
+		}
+	}
+	return extraFiles, units, moduleDirs, nil
+}
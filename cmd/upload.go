@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"maze/cmd/ux"
+
+	"github.com/spf13/cobra"
+)
+
+// Largest upload allowed, in MB.
+var maxUploadSize int64
+
+// addUploadFlags registers the flags that control how the collected files are
+// checked, redacted and sent, on a command that uploads them.
+func addUploadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&uploadMode, "upload-mode", "", "auto", "How files are sent: archive, legacy, or auto to fall back to legacy for older servers")
+	cmd.Flags().Int64VarP(&maxUploadSize, "max-upload-size", "", 100, "The largest upload allowed in MB (0 disables the limit)")
+	cmd.Flags().StringSliceVarP(&redactKeys, "redact-keys", "", []string{"password", "secret", "token", "private_key"}, "Mask state and tfvars values whose keys match these patterns")
+	cmd.Flags().BoolVarP(&skipState, "no-state", "", false, "Do not upload .tfstate files")
+	cmd.Flags().BoolVarP(&skipVariables, "no-tfvars", "", false, "Do not upload .tfvars files")
+	cmd.Flags().BoolVarP(&allowSecrets, "allow-secrets", "", false, "Upload even when hard-coded credentials are found")
+}
+
+// size returns the combined size of the collected files.
+func (c fileCollection) size() (total int64) {
+	for _, file := range c.files {
+		total += file.size
+	}
+	return
+}
+
+// checkUploadSize refuses uploads above --max-upload-size and names the
+// largest files so they can be ignored.
+func checkUploadSize(collection fileCollection) error {
+	limit := maxUploadSize * 1024 * 1024
+	total := collection.size()
+	if limit <= 0 || total <= limit {
+		return nil
+	}
+
+	files := append([]collectedFile{}, collection.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].size > files[j].size })
+	if len(files) > 5 {
+		files = files[:5]
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "Upload of %s is larger than the maximum of %s (change with --max-upload-size or add files to .mazeignore)\nLargest files:\n", ux.FormatBytes(total), ux.FormatBytes(limit))
+	for _, file := range files {
+		fmt.Fprintf(&message, " - %s (%s)\n", file.relativePath, ux.FormatBytes(file.size))
+	}
+	return fmt.Errorf("%s", strings.TrimSuffix(message.String(), "\n"))
+}
+
+// newStreamingRequest creates a POST request whose multipart body is written
+// by write while it is being sent, so the files are never held in memory.
+// The body can be produced again, which lets doAuthorized retry the request.
+func newStreamingRequest(endpoint string, write func(writer *multipart.Writer) error) (*http.Request, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	newBody := func() (io.ReadCloser, error) {
+		return &streamingBody{start: func() *io.PipeReader {
+			reader, pipeWriter := io.Pipe()
+			writer := multipart.NewWriter(pipeWriter)
+			writer.SetBoundary(boundary)
+			go func() {
+				err := write(writer)
+				if err == nil {
+					err = writer.Close()
+				}
+				pipeWriter.CloseWithError(err)
+			}()
+			return reader
+		}}, nil
+	}
+
+	body, _ := newBody()
+	req, err := http.NewRequest("POST", endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.GetBody = newBody
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	return req, nil
+}
+
+// streamingBody starts writing a request body on the first read, so a body
+// that is never sent, like one replaced through GetBody, starts no writer.
+// Closing it stops a writer that was started.
+type streamingBody struct {
+	start  func() *io.PipeReader
+	mu     sync.Mutex
+	reader *io.PipeReader
+	closed bool
+}
+
+func (b *streamingBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.reader == nil && !b.closed {
+		b.reader = b.start()
+	}
+	reader := b.reader
+	b.mu.Unlock()
+	if reader == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return reader.Read(p)
+}
+
+func (b *streamingBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.reader != nil {
+		return b.reader.Close()
+	}
+	return nil
+}
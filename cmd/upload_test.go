@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStreamingRequestStartsOnRead(t *testing.T) {
+	var started atomic.Int32
+	req, err := newStreamingRequest("http://maze.test/upload", func(writer *multipart.Writer) error {
+		started.Add(1)
+		return writer.WriteField("name", "value")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replacing the body, as a retry does, must not leave a writer behind.
+	req.Body.Close()
+	body, err := req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := started.Load(); count != 0 {
+		t.Fatalf("%d writers started before the body was read", count)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+	if !strings.Contains(string(data), "value") || !strings.Contains(req.Header.Get("Content-Type"), "boundary=") {
+		t.Errorf("body = %q", data)
+	}
+	if count := started.Load(); count != 1 {
+		t.Errorf("%d writers started, want 1", count)
+	}
+}
+
+func TestArchiveSupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   bool
+	}{
+		{"options answered", http.StatusOK, true},
+		{"options not allowed", http.StatusMethodNotAllowed, true},
+		{"no archive endpoint", http.StatusNotFound, false},
+		{"options not implemented", http.StatusNotImplemented, false},
+	}
+	serverURL := url
+	defer func() { url = serverURL }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodOptions || r.URL.Path != "/api/cli/submitArchive/" {
+					t.Errorf("request = %s %s, want OPTIONS /api/cli/submitArchive/", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+			url = server.URL
+			if got := archiveSupported(); got != test.want {
+				t.Errorf("archiveSupported = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package ux
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// - - - Browser helpers - - -
+
+// OpenBrowser opens the given url in the user's default browser.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,109 @@
+package ux
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// - - - Custom Progress Bar Struct - - -
+
+// Width of the bar in characters
+const progressWidth = 30
+
+// Custom progress bar struct, safe to update from another goroutine
+type Progress struct {
+	label    string
+	total    int64
+	current  int64
+	lastDraw time.Time
+	mutex    sync.Mutex
+}
+
+// Method to instantiate a progress bar for the given number of bytes
+func NewProgress(label string, total int64) *Progress {
+	return &Progress{label: label, total: total}
+}
+
+// Method to reset the bar when the same bytes are sent again
+func (p *Progress) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.current = 0
+	p.draw()
+}
+
+// Method to add to the number of bytes done
+func (p *Progress) Add(n int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.current += n
+	// Redrawing at most every 100ms to keep the terminal calm
+	if time.Since(p.lastDraw) >= 100*time.Millisecond || p.current >= p.total {
+		p.draw()
+	}
+}
+
+// Method to wrap a reader so everything read from it is counted
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r, p}
+}
+
+// Method to replace the bar with a success message
+func (p *Progress) Success(message string) {
+	p.finish(PrintBlue("✔"), message)
+}
+
+// Method to replace the bar with a failure message
+func (p *Progress) Fail(message string) {
+	p.finish(PrintRed("✘"), message)
+}
+
+// Method to replace the bar with a neutral notice
+func (p *Progress) Notice(message string) {
+	p.finish(PrintBlue("ℹ"), message)
+}
+
+func (p *Progress) finish(symbol string, message string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fmt.Printf("\r\033[K%s %s\n", symbol, message)
+}
+
+func (p *Progress) draw() {
+	p.lastDraw = time.Now()
+	percent := 100
+	if p.total > 0 && p.current < p.total {
+		percent = int(p.current * 100 / p.total)
+	}
+	filled := percent * progressWidth / 100
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressWidth-filled)
+	fmt.Printf("\r\033[K%s %s %3d%% %s / %s", p.label, PrintBlue(bar), percent, FormatBytes(p.current), FormatBytes(p.total))
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress *Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.progress.Add(int64(n))
+	return n, err
+}
+
+// Function to format a number of bytes for people
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
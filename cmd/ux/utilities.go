@@ -40,9 +40,140 @@ var LongTextConfigure = fmt.Sprintf(`%s
 %s`, MazeLogo, ShortTextConfigure,
 )
 
+var ShortTextLogin = `Log in to maze from your browser and store the tokens in a profile`
+var LongTextLogin = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextLogin,
+)
+
+var ShortTextLogout = `Revoke and remove the tokens stored in a profile`
+var LongTextLogout = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextLogout,
+)
+
+var ShortTextConfig = `Inspect the project configuration read from .maze.yaml`
+var LongTextConfig = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextConfig,
+)
+
+var ShortTextConfigShow = `Show the effective configuration and where each value came from`
+var LongTextConfigShow = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextConfigShow,
+)
+
+var ShortTextInventory = `List what maze will see in your terraform files, without contacting the server`
+var LongTextInventory = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextInventory,
+)
+
+var ShortTextCost = `Get the cost of a project, or estimate it offline from a local price catalog`
+var LongTextCost = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextCost,
+)
+
+var ShortTextCatalog = `Manage the local price catalog used by maze cost --offline`
+var LongTextCatalog = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextCatalog,
+)
+
+var ShortTextCatalogImport = `Import CSV price sheets into the local price catalog`
+var LongTextCatalogImport = fmt.Sprintf(`%s
+
+%s
+
+The CSV needs a resource column and an hourly_cost or monthly_cost column.
+region, description and per (the attribute the price is multiplied by, such
+as size for a price per GB) are optional. Any other column, such as
+instance_type or sku, is an attribute the resource has to match.`, MazeLogo, ShortTextCatalogImport,
+)
+
+var ShortTextVisualize = `Draw an architecture diagram of your terraform, or fetch the canvas image of a project`
+var LongTextVisualize = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextVisualize,
+)
+
+var ShortTextComply = `Run compliance checks on your terraform, on the server or locally with --local`
+var LongTextComply = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextComply,
+)
+
+var ShortTextProjects = `Manage the projects maze plan created on the server`
+var LongTextProjects = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextProjects,
+)
+
+var ShortTextProjectsList = `List your maze projects, filtered by name or creation date`
+var LongTextProjectsList = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextProjectsList,
+)
+
+var ShortTextProjectsShow = `Show a maze project with its cost and compliance summary`
+var LongTextProjectsShow = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextProjectsShow,
+)
+
+var ShortTextProjectsOpen = `Open the canvas of a maze project in your browser`
+var LongTextProjectsOpen = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextProjectsOpen,
+)
+
+var ShortTextProjectsDelete = `Delete maze projects by id, or every project older than an age`
+var LongTextProjectsDelete = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextProjectsDelete,
+)
+
+var ShortTextHistory = `Show the cost and compliance of past runs, their trends and any regressions`
+var LongTextHistory = fmt.Sprintf(`%s
+
+%s`, MazeLogo, ShortTextHistory,
+)
+
 type Profile struct {
-	ProfileName string `json:"profileName"`
-	AuthToken   string `json:"authToken"`
+	ProfileName  string `json:"profileName"`
+	AuthToken    string `json:"authToken"`
+	TokenType    string `json:"tokenType,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	TokenURL     string `json:"tokenUrl,omitempty"`
+	RevokeURL    string `json:"revokeUrl,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+}
+
+// UnmarshalJSON accepts both the profile object and the plain token string
+// written by older versions of the cli.
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var authToken string
+	if err := json.Unmarshal(data, &authToken); err == nil {
+		*p = Profile{AuthToken: authToken}
+		return nil
+	}
+	type profileAlias Profile
+	var profile profileAlias
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return err
+	}
+	*p = Profile(profile)
+	return nil
+}
+
+// AuthHeader returns the value to send in the Authorization header.
+func (p Profile) AuthHeader() string {
+	if p.TokenType == "" {
+		return p.AuthToken
+	}
+	return p.TokenType + " " + p.AuthToken
 }
 
 // GetProfileDir returns the path to the user's home directory.
@@ -64,28 +195,44 @@ func GetProfileDir() (string, error) {
 
 // GetAuthToken retrieves the auth token for a specific profile.
 func GetAuthToken(profileName string) (string, error) {
+	profile, err := GetProfile(profileName)
+	if err != nil {
+		return "", err
+	}
+
+	return profile.AuthHeader(), nil
+}
+
+// GetProfile retrieves a single stored profile by name.
+func GetProfile(profileName string) (Profile, error) {
 	// Load existing profiles.
 	profiles, err := LoadProfiles()
 	if err != nil {
-		return "", fmt.Errorf("could not load profiles: %w", err)
+		return Profile{}, fmt.Errorf("could not load profiles: %w", err)
 	}
 
-	// Retrieve the auth token for the specified profile.
-	authToken, exists := profiles[profileName]
+	profile, exists := profiles[profileName]
 	if !exists {
-		return "", fmt.Errorf("profile %s not found", profileName)
+		return Profile{}, fmt.Errorf("profile %s not found", profileName)
 	}
+	profile.ProfileName = profileName
 
-	return authToken, nil
+	return profile, nil
 }
 
 // SaveProfile saves a profile to a file in a hidden folder in the user's home directory.
 func SaveProfile(profile Profile) error {
-
-	filePath, err := GetProfileDir()
-	if err != nil {
+	if err := StoreProfile(profile); err != nil {
 		return err
 	}
+
+	fmt.Printf("Profile data successfully saved for profile %s\n", profile.ProfileName)
+	return nil
+}
+
+// StoreProfile adds or updates a profile without printing anything, so it can
+// be used when tokens are refreshed in the middle of a run.
+func StoreProfile(profile Profile) error {
 	// Load existing profiles if the file already exists.
 	profiles, err := LoadProfiles()
 	if err != nil {
@@ -93,30 +240,13 @@ func SaveProfile(profile Profile) error {
 	}
 
 	// Add or update the profile in the list of profiles.
-	profiles[profile.ProfileName] = profile.AuthToken
+	profiles[profile.ProfileName] = profile
 
-	// Marshal the profiles map to JSON.
-	jsonData, err := json.MarshalIndent(profiles, "", "  ")
-	if err != nil {
-		return fmt.Errorf("could not marshal profiles to JSON: %w", err)
-	}
-
-	// Write the JSON data to the file.
-	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
-		return fmt.Errorf("could not write to file %s: %w", filePath, err)
-	}
-
-	fmt.Printf("Profile data successfully saved for profile %s\n", profile.ProfileName)
-	return nil
+	return writeProfiles(profiles)
 }
 
 // DeleteProfile removes a profile from the profiles.json file by name.
 func DeleteProfile(profileName string) error {
-	filePath, err := GetProfileDir()
-	if err != nil {
-		return err
-	}
-
 	// Load existing profiles.
 	profiles, err := LoadProfiles()
 	if err != nil {
@@ -132,22 +262,51 @@ func DeleteProfile(profileName string) error {
 	delete(profiles, profileName)
 
 	// Save the updated profiles back to the file.
+	if err := writeProfiles(profiles); err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile %s successfully deleted\n", profileName)
+	return nil
+}
+
+// writeProfiles replaces the profiles file with the given profiles. The file
+// holds credentials, so it is only readable by the current user.
+func writeProfiles(profiles map[string]Profile) error {
+	filePath, err := GetProfileDir()
+	if err != nil {
+		return err
+	}
+
+	// Marshal the profiles map to JSON.
 	jsonData, err := json.MarshalIndent(profiles, "", "  ")
 	if err != nil {
 		return fmt.Errorf("could not marshal profiles to JSON: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
+	// Write the JSON data to a new file and move it over the old one, so a
+	// file left readable by an older version does not keep its permissions.
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".profiles-*")
+	if err != nil {
+		return fmt.Errorf("could not write to file %s: %w", filePath, err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(jsonData); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write to file %s: %w", filePath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write to file %s: %w", filePath, err)
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
 		return fmt.Errorf("could not write to file %s: %w", filePath, err)
 	}
-
-	fmt.Printf("Profile %s successfully deleted\n", profileName)
 	return nil
 }
 
 // loadProfiles loads the profiles from the specified file path.
-func LoadProfiles() (map[string]string, error) {
-	profiles := make(map[string]string)
+func LoadProfiles() (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
 	filePath, err := GetProfileDir()
 
 	// Check if the profiles file exists.
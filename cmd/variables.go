@@ -0,0 +1,302 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// tfvars generated from --var-file, --var and TF_VAR_ values. terraform loads
+// .auto.tfvars files in lexical order, so the name sorts after any other.
+const overridesName = "zzz_maze_overrides.auto.tfvars"
+
+var (
+	// --var and --var-file flags in the order they were given.
+	variableArgs []variableArg
+	skipEnvVars  bool
+)
+
+// A --var or --var-file flag.
+type variableArg struct {
+	flag  string
+	value string
+}
+
+// variableFlag is the value of the --var and --var-file flags. Both append
+// to variableArgs so the values are applied in command line order, the way
+// terraform applies -var and -var-file.
+type variableFlag struct {
+	name string
+}
+
+func (f variableFlag) String() string {
+	var values []string
+	for _, arg := range variableArgs {
+		if arg.flag == f.name {
+			values = append(values, arg.value)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (f variableFlag) Set(value string) error {
+	variableArgs = append(variableArgs, variableArg{f.name, value})
+	return nil
+}
+
+func (f variableFlag) Type() string {
+	return "stringArray"
+}
+
+// Variable values in the order terraform applies them, later ones winning.
+type variableValues struct {
+	names  []string
+	tokens map[string]hclwrite.Tokens
+}
+
+func (v *variableValues) set(name string, tokens hclwrite.Tokens) {
+	if v.tokens == nil {
+		v.tokens = map[string]hclwrite.Tokens{}
+	}
+	if _, exists := v.tokens[name]; !exists {
+		v.names = append(v.names, name)
+	}
+	v.tokens[name] = tokens
+}
+
+// isAutoVariablesFile reports whether terraform loads a variables file
+// without being asked to.
+func isAutoVariablesFile(path string) bool {
+	fileName := filepath.Base(path)
+	return fileName == "terraform.tfvars" || fileName == "terraform.tfvars.json" ||
+		strings.HasSuffix(fileName, ".auto.tfvars") || strings.HasSuffix(fileName, ".auto.tfvars.json")
+}
+
+// selectVariables keeps the variables files terraform would load for this
+// run: the auto loaded ones and those given with --var-file. The values of
+// --var-file, --var and TF_VAR_ variables are resolved in terraform's order
+// into a generated .auto.tfvars, so the server applies them without being
+// told which files to use. It returns the paths of the --var-file files and
+// the TF_VAR_ variables that were used.
+func selectVariables(root string, files []collectedFile) (selected []collectedFile, chosen []string, environmentUsed []string, err error) {
+	chosenFiles := map[string]bool{}
+	for _, arg := range variableArgs {
+		if arg.flag != "var-file" {
+			continue
+		}
+		varFile := arg.value
+		if !filepath.IsAbs(varFile) {
+			varFile = filepath.Join(root, varFile)
+		}
+		chosen = append(chosen, filepath.Clean(varFile))
+		chosenFiles[filepath.Clean(varFile)] = true
+	}
+
+	var autoFiles []string
+	for _, file := range files {
+		if isVariablesFile(file.path) && !chosenFiles[file.path] && !isAutoVariablesFile(file.path) {
+			continue
+		}
+		if isAutoVariablesFile(file.path) && filepath.Dir(file.path) == root {
+			autoFiles = append(autoFiles, file.path)
+		}
+		if chosenFiles[file.path] {
+			delete(chosenFiles, file.path)
+		}
+		selected = append(selected, file)
+	}
+	// Files given with --var-file that the walk did not collect, such as
+	// ones outside of --dir. JSON files cannot be redacted in place, so only
+	// their values are sent, through the generated file.
+	for _, varFile := range chosen {
+		if !chosenFiles[varFile] {
+			continue
+		}
+		info, err := os.Stat(varFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not read variables file %s: %v", varFile, err)
+		}
+		if !strings.HasSuffix(varFile, ".json") {
+			selected = append(selected, collectedFile{path: varFile, size: info.Size()})
+		}
+		delete(chosenFiles, varFile)
+	}
+
+	environment := map[string]string{}
+	if !skipEnvVars {
+		environment = environmentVariables()
+	}
+	if len(variableArgs) == 0 && len(environment) == 0 {
+		return selected, nil, nil, nil
+	}
+
+	// Values already set by the auto loaded files, which beat TF_VAR_ values.
+	var values variableValues
+	setByFiles := map[string]bool{}
+	for _, autoFile := range autoFiles {
+		fileValues, err := readVariablesFile(autoFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, variableName := range fileValues.names {
+			setByFiles[variableName] = true
+		}
+	}
+
+	declared := declaredVariables(files, root)
+	environmentNames := make([]string, 0, len(environment))
+	for variableName := range environment {
+		environmentNames = append(environmentNames, variableName)
+	}
+	sort.Strings(environmentNames)
+	for _, variableName := range environmentNames {
+		// terraform ignores TF_VAR_ values for variables the root does not
+		// declare.
+		if declared[variableName] && !setByFiles[variableName] {
+			values.set(variableName, inlineValueTokens(environment[variableName]))
+			environmentUsed = append(environmentUsed, "TF_VAR_"+variableName)
+		}
+	}
+
+	for _, arg := range variableArgs {
+		if arg.flag == "var-file" {
+			varFile := arg.value
+			if !filepath.IsAbs(varFile) {
+				varFile = filepath.Join(root, varFile)
+			}
+			fileValues, err := readVariablesFile(filepath.Clean(varFile))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for _, variableName := range fileValues.names {
+				values.set(variableName, fileValues.tokens[variableName])
+			}
+			continue
+		}
+		variableName, value, found := strings.Cut(arg.value, "=")
+		if !found || strings.TrimSpace(variableName) == "" {
+			return nil, nil, nil, fmt.Errorf("invalid --var %q, expected name=value", arg.value)
+		}
+		variableName = strings.TrimSpace(variableName)
+		values.set(variableName, inlineValueTokens(value))
+	}
+
+	if len(values.names) == 0 {
+		return selected, chosen, environmentUsed, nil
+	}
+	overrides := hclwrite.NewEmptyFile()
+	for _, variableName := range values.names {
+		overrides.Body().SetAttributeRaw(variableName, values.tokens[variableName])
+	}
+	content := append([]byte("# Generated by maze from --var-file, --var and TF_VAR_ values.\n"), overrides.Bytes()...)
+	selected = append(selected, collectedFile{
+		path:    filepath.Join(root, overridesName),
+		size:    int64(len(content)),
+		content: content,
+	})
+	return selected, chosen, environmentUsed, nil
+}
+
+// readVariablesFile reads the values of a .tfvars or .tfvars.json file as
+// written, so expressions survive the copy into the overrides file.
+func readVariablesFile(path string) (values variableValues, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values, fmt.Errorf("could not read variables file %s: %v", path, err)
+	}
+
+	if strings.HasSuffix(path, ".json") {
+		impliedType, err := ctyjson.ImpliedType(data)
+		if err != nil || !impliedType.IsObjectType() {
+			return values, fmt.Errorf("could not parse variables file %s: expected a JSON object", path)
+		}
+		object, err := ctyjson.Unmarshal(data, impliedType)
+		if err != nil {
+			return values, fmt.Errorf("could not parse variables file %s: %v", path, err)
+		}
+		objectValues := object.AsValueMap()
+		names := make([]string, 0, len(objectValues))
+		for variableName := range objectValues {
+			names = append(names, variableName)
+		}
+		sort.Strings(names)
+		for _, variableName := range names {
+			values.set(variableName, hclwrite.TokensForValue(objectValues[variableName]))
+		}
+		return values, nil
+	}
+
+	file, diags := hclwrite.ParseConfig(data, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return values, fmt.Errorf("could not parse variables file %s: %s", path, diags.Error())
+	}
+	attributes := file.Body().Attributes()
+	names := make([]string, 0, len(attributes))
+	for variableName := range attributes {
+		names = append(names, variableName)
+	}
+	sort.Strings(names)
+	for _, variableName := range names {
+		values.set(variableName, attributes[variableName].Expr().BuildTokens(nil))
+	}
+	return values, nil
+}
+
+// inlineValueTokens turns a --var or TF_VAR_ value into tfvars syntax. Like
+// terraform, lists and maps are read as HCL and anything else as a string.
+func inlineValueTokens(value string) hclwrite.Tokens {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		file, diags := hclwrite.ParseConfig([]byte("value = "+trimmed+"\n"), "--var", hcl.Pos{Line: 1, Column: 1})
+		if !diags.HasErrors() {
+			if attr := file.Body().GetAttribute("value"); attr != nil {
+				return attr.Expr().BuildTokens(nil)
+			}
+		}
+	}
+	return hclwrite.TokensForValue(cty.StringVal(value))
+}
+
+// environmentVariables returns the TF_VAR_ values from the environment by
+// variable name.
+func environmentVariables() map[string]string {
+	values := map[string]string{}
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if variableName, found := strings.CutPrefix(name, "TF_VAR_"); found && variableName != "" {
+			values[variableName] = value
+		}
+	}
+	return values
+}
+
+// declaredVariables returns the names of the variables the root module
+// declares.
+func declaredVariables(files []collectedFile, root string) map[string]bool {
+	declared := map[string]bool{}
+	for _, file := range files {
+		if !isConfigFile(file.path) || filepath.Dir(file.path) != root {
+			continue
+		}
+		body, err := parseHCLFile(file.path)
+		if err != nil {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type == "variable" && len(block.Labels) == 1 {
+				declared[block.Labels[0]] = true
+			}
+		}
+	}
+	return declared
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// overridesContent runs selectVariables on root and returns the generated
+// overrides file with its spacing collapsed, or "" when none was written.
+func overridesContent(t *testing.T, root string) (string, []string) {
+	t.Helper()
+	var files []collectedFile
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		files = append(files, collectedFile{path: filepath.Join(root, entry.Name())})
+	}
+	selected, _, environmentUsed, err := selectVariables(root, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range selected {
+		if filepath.Base(file.path) == overridesName {
+			// hclwrite aligns the equals signs.
+			return strings.Join(strings.Fields(string(file.content)), " "), environmentUsed
+		}
+	}
+	return "", environmentUsed
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSelectVariablesOrder(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"main.tf":     "variable \"size\" {}\nvariable \"region\" {}\n",
+		"x.tfvars":    "size = \"file\"\n",
+		"auto.tfvars": "",
+	})
+	t.Setenv("TF_VAR_size", "env")
+	t.Setenv("TF_VAR_region", "env-region")
+
+	tests := []struct {
+		name string
+		args []variableArg
+		want string
+	}{
+		{"var then file", []variableArg{{"var", "size=flag"}, {"var-file", "x.tfvars"}}, `size = "file"`},
+		{"file then var", []variableArg{{"var-file", "x.tfvars"}, {"var", "size=flag"}}, `size = "flag"`},
+		{"var twice", []variableArg{{"var", "size=one"}, {"var", "size=two"}}, `size = "two"`},
+		{"environment only", nil, `size = "env"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			variableArgs = test.args
+			defer func() { variableArgs = nil }()
+			content, _ := overridesContent(t, root)
+			if !strings.Contains(content, test.want) {
+				t.Errorf("overrides = %q, want %q", content, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectVariablesEnvironment(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"main.tf":          "variable \"size\" {}\nvariable \"region\" {}\n",
+		"terraform.tfvars": "region = \"file\"\n",
+	})
+	t.Setenv("TF_VAR_size", "env")
+	t.Setenv("TF_VAR_region", "env")
+	t.Setenv("TF_VAR_undeclared", "env")
+
+	content, used := overridesContent(t, root)
+	if want := []string{"TF_VAR_size"}; !reflect.DeepEqual(used, want) {
+		t.Errorf("environment used = %v, want %v", used, want)
+	}
+	if !strings.Contains(content, `size = "env"`) || strings.Contains(content, "region") {
+		t.Errorf("overrides = %q", content)
+	}
+
+	skipEnvVars = true
+	defer func() { skipEnvVars = false }()
+	content, used = overridesContent(t, root)
+	if content != "" || len(used) != 0 {
+		t.Errorf("with --no-env-vars overrides = %q, environment used = %v", content, used)
+	}
+}
+
+func TestInvalidVar(t *testing.T) {
+	root := writeFiles(t, map[string]string{"main.tf": ""})
+	variableArgs = []variableArg{{"var", "novalue"}}
+	defer func() { variableArgs = nil }()
+	if _, _, _, err := selectVariables(root, nil); err == nil {
+		t.Error("expected an error for --var without =")
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"maze/cmd/ux"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	visualizeFormat string
+	visualizeOutput string
+)
+
+// visualizeCmd represents the visualize command
+var visualizeCmd = &cobra.Command{
+	Use:   "visualize",
+	Short: ux.ShortTextVisualize,
+	Long:  ux.LongTextVisualize,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := applyProjectConfig(cmd); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := mazeVisualize(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func mazeVisualize() error {
+	if !offline {
+		if projectID == "" {
+			return errors.New("use --project-id to fetch the canvas image of a maze project, or --offline to draw the diagram locally")
+		}
+		if err := checkImageOptions(); err != nil {
+			return err
+		}
+		if imageOut == "" {
+			imageOut = visualizeOutput
+		}
+		if !authStep() {
+			return errors.New("authentication failed")
+		}
+		if !imageStep(projectID) {
+			return errors.New("generating the canvas image failed")
+		}
+		return nil
+	}
+
+	if visualizeFormat != "dot" && visualizeFormat != "mermaid" && visualizeFormat != "svg" {
+		return errors.New("format needs to be one of dot, mermaid or svg")
+	}
+	collection, err := collectFiles()
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		return err
+	}
+	graph := buildGraph(collection.files, root)
+	if len(graph.nodes) == 0 {
+		return fmt.Errorf("no resources found in %s", dirPath)
+	}
+
+	var diagram []byte
+	switch visualizeFormat {
+	case "dot":
+		diagram = renderDot(graph)
+	case "mermaid":
+		diagram = renderMermaid(graph)
+		// Fenced so it can be pasted into Markdown, unless it goes to a file
+		// for mermaid tools.
+		if ext := filepath.Ext(visualizeOutput); ext != ".mmd" && ext != ".mermaid" {
+			diagram = append(append([]byte("```mermaid\n"), diagram...), "```\n"...)
+		}
+	default:
+		if diagram, err = renderSVG(graph); err != nil {
+			return err
+		}
+	}
+
+	if visualizeOutput == "" {
+		os.Stdout.Write(diagram)
+		return nil
+	}
+	if err := os.WriteFile(visualizeOutput, diagram, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", visualizeOutput, err)
+	}
+	fmt.Println(ux.PrintGreen("✔"), "Diagram saved to", visualizeOutput)
+	return nil
+}
+
+// renderDot writes the graph in Graphviz DOT, with clusters as subgraphs.
+func renderDot(graph resourceGraph) []byte {
+	var b bytes.Buffer
+	children := graph.children()
+	quote := func(value string) string { return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"` }
+
+	b.WriteString("digraph maze {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#eef4ff\", color=\"#0562fe\", fontname=\"Helvetica\"];\n")
+	var write func(address string, indent string)
+	write = func(address string, indent string) {
+		if len(children[address]) == 0 {
+			b.WriteString(indent + quote(address) + ";\n")
+			return
+		}
+		b.WriteString(indent + "subgraph " + quote("cluster_"+address) + " {\n")
+		b.WriteString(indent + "  label=" + quote(address) + ";\n")
+		b.WriteString(indent + "  style=rounded;\n")
+		b.WriteString(indent + "  " + quote(address) + ";\n")
+		for _, child := range children[address] {
+			write(child, indent+"  ")
+		}
+		b.WriteString(indent + "}\n")
+	}
+	for _, address := range children[""] {
+		write(address, "  ")
+	}
+	for _, address := range graph.sortedAddresses() {
+		for _, dependency := range graph.edges[address] {
+			b.WriteString("  " + quote(address) + " -> " + quote(dependency) + ";\n")
+		}
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// renderMermaid writes the graph as a Mermaid flowchart, with clusters as
+// subgraphs.
+func renderMermaid(graph resourceGraph) []byte {
+	var b bytes.Buffer
+	children := graph.children()
+	ids := map[string]string{}
+	for i, address := range graph.sortedAddresses() {
+		ids[address] = fmt.Sprintf("n%d", i)
+	}
+	label := func(value string) string { return `["` + strings.ReplaceAll(value, `"`, "#quot;") + `"]` }
+
+	b.WriteString("flowchart LR\n")
+	var write func(address string, indent string)
+	write = func(address string, indent string) {
+		if len(children[address]) == 0 {
+			b.WriteString(indent + ids[address] + label(address) + "\n")
+			return
+		}
+		b.WriteString(indent + "subgraph c" + ids[address] + label(address) + "\n")
+		b.WriteString(indent + "  " + ids[address] + label(address) + "\n")
+		for _, child := range children[address] {
+			write(child, indent+"  ")
+		}
+		b.WriteString(indent + "end\n")
+	}
+	for _, address := range children[""] {
+		write(address, "  ")
+	}
+	for _, address := range graph.sortedAddresses() {
+		for _, dependency := range graph.edges[address] {
+			b.WriteString("  " + ids[address] + " --> " + ids[dependency] + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// renderSVG renders the graph with Graphviz when it is installed, and with a
+// simple built in layout otherwise.
+func renderSVG(graph resourceGraph) ([]byte, error) {
+	if dot, err := exec.LookPath("dot"); err == nil {
+		var stdout, stderr bytes.Buffer
+		run := exec.Command(dot, "-Tsvg")
+		run.Stdin = bytes.NewReader(renderDot(graph))
+		run.Stdout = &stdout
+		run.Stderr = &stderr
+		if err := run.Run(); err == nil {
+			return stdout.Bytes(), nil
+		}
+	}
+	return layoutSVG(graph), nil
+}
+
+// Sizes used by the built in SVG layout.
+const (
+	svgNodeHeight   = 36
+	svgPadding      = 16
+	svgHeader       = 24
+	svgCharWidth    = 7
+	svgRowNodes     = 4
+	svgMinNodeWidth = 140
+)
+
+// A placed box in the built in SVG layout.
+type svgBox struct {
+	x, y, width, height float64
+}
+
+// layoutSVG lays the top level nodes out in rows and stacks the contents of
+// each cluster inside its box, then draws the references as straight arrows.
+func layoutSVG(graph resourceGraph) []byte {
+	children := graph.children()
+	sizes := map[string]svgBox{}
+	var measure func(address string) svgBox
+	measure = func(address string) svgBox {
+		nodeWidth := math.Max(svgMinNodeWidth, float64(len(address)*svgCharWidth+2*svgPadding))
+		if len(children[address]) == 0 {
+			sizes[address] = svgBox{width: nodeWidth, height: svgNodeHeight}
+			return sizes[address]
+		}
+		// The cluster resource itself comes first, then its contents.
+		box := svgBox{width: nodeWidth, height: svgHeader + svgNodeHeight + svgPadding}
+		for _, child := range children[address] {
+			size := measure(child)
+			box.width = math.Max(box.width, size.width)
+			box.height += size.height + svgPadding
+		}
+		box.width += 2 * svgPadding
+		box.height += svgPadding
+		sizes[address] = box
+		return box
+	}
+
+	var body bytes.Buffer
+	nodes := map[string]svgBox{}
+	var place func(address string, x float64, y float64)
+	place = func(address string, x float64, y float64) {
+		size := sizes[address]
+		if len(children[address]) == 0 {
+			nodes[address] = svgBox{x, y, size.width, size.height}
+			return
+		}
+		fmt.Fprintf(&body, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="8" fill="none" stroke="#0562fe" stroke-dasharray="4 3"/>`+"\n", x, y, size.width, size.height)
+		fmt.Fprintf(&body, `<text x="%.0f" y="%.0f" font-size="12" fill="#0562fe">%s</text>`+"\n", x+svgPadding, y+17, html.EscapeString(address))
+		childY := y + svgHeader
+		nodes[address] = svgBox{x + svgPadding, childY, sizes[address].width - 2*svgPadding, svgNodeHeight}
+		childY += svgNodeHeight + svgPadding
+		for _, child := range children[address] {
+			place(child, x+svgPadding, childY)
+			childY += sizes[child].height + svgPadding
+		}
+	}
+
+	x, y, rowHeight, width := float64(svgPadding), float64(svgPadding), 0.0, 0.0
+	for i, address := range children[""] {
+		size := measure(address)
+		if i > 0 && i%svgRowNodes == 0 {
+			x, y, rowHeight = svgPadding, y+rowHeight+2*svgPadding, 0
+		}
+		place(address, x, y)
+		x += size.width + 2*svgPadding
+		rowHeight = math.Max(rowHeight, size.height)
+		width = math.Max(width, x)
+	}
+	height := y + rowHeight + svgPadding
+
+	for _, address := range graph.sortedAddresses() {
+		box := nodes[address]
+		fmt.Fprintf(&body, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="6" fill="#eef4ff" stroke="#0562fe"/>`+"\n", box.x, box.y, box.width, box.height)
+		fmt.Fprintf(&body, `<text x="%.0f" y="%.0f" font-size="12" text-anchor="middle">%s</text>`+"\n", box.x+box.width/2, box.y+box.height/2+4, html.EscapeString(address))
+	}
+	for _, address := range graph.sortedAddresses() {
+		from := nodes[address]
+		for _, dependency := range graph.edges[address] {
+			to := nodes[dependency]
+			x1, y1 := from.x+from.width/2, from.y+from.height/2
+			x2, y2 := to.x+to.width/2, to.y+to.height/2
+			x1, y1 = clipToBox(from, x1, y1, x2, y2)
+			x2, y2 = clipToBox(to, x2, y2, x1, y1)
+			fmt.Fprintf(&body, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" stroke="#555" marker-end="url(#arrow)"/>`+"\n", x1, y1, x2, y2)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Helvetica, Arial, sans-serif">`+"\n", width, height, width, height)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="#555"/></marker></defs>` + "\n")
+	b.Write(body.Bytes())
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// clipToBox moves a point at the centre of box to where the line towards
+// (toX, toY) leaves the box.
+func clipToBox(box svgBox, x float64, y float64, toX float64, toY float64) (float64, float64) {
+	dx, dy := toX-x, toY-y
+	if dx == 0 && dy == 0 {
+		return x, y
+	}
+	scale := math.Inf(1)
+	if dx != 0 {
+		scale = math.Min(scale, box.width/2/math.Abs(dx))
+	}
+	if dy != 0 {
+		scale = math.Min(scale, box.height/2/math.Abs(dy))
+	}
+	return x + dx*scale, y + dy*scale
+}
+
+func init() {
+
+	visualizeCmd.Flags().StringVarP(&dirPath, "dir", "d", "./", "The directory for terraform files")
+	visualizeCmd.Flags().StringVarP(&profileName, "profile", "p", "default", "The profile to get the auth token from")
+	visualizeCmd.Flags().StringVarP(&url, "url", "u", "https://maze-multicloud.com", "The url for the maze instance you are using")
+	addClientFlags(visualizeCmd)
+	visualizeCmd.Flags().StringVarP(&projectID, "project-id", "", "", "The maze project to fetch the canvas image of")
+	visualizeCmd.Flags().BoolVarP(&offline, "offline", "", false, "Draw the diagram locally without contacting the server")
+	visualizeCmd.Flags().StringVarP(&visualizeFormat, "format", "f", "mermaid", "Format of the offline diagram: dot, mermaid or svg")
+	visualizeCmd.Flags().StringVarP(&visualizeOutput, "output", "o", "", "Write the offline diagram to this file instead of printing it, or the canvas image instead of the output folder")
+	visualizeCmd.Flags().StringVarP(&imageFormat, "image-format", "", "png", "The format of the canvas image: png, svg or pdf")
+	visualizeCmd.Flags().IntVarP(&imageWidth, "image-width", "", 0, "The width of the canvas image in pixels (0 lets the server choose)")
+	visualizeCmd.Flags().StringVarP(&imageTheme, "theme", "", "light", "The theme of the canvas image: light or dark")
+	visualizeCmd.Flags().StringVarP(&imageOut, "image-out", "", "", "Where to save the canvas image instead of the output folder")
+	visualizeCmd.Flags().StringSliceVarP(&includeGlobs, "include", "", nil, "Only read files matching these gitignore style patterns")
+	visualizeCmd.Flags().StringSliceVarP(&excludeGlobs, "exclude", "", nil, "Never read files matching these gitignore style patterns")
+	visualizeCmd.Flags().BoolVarP(&useGitignore, "gitignore", "", false, "Also skip files ignored by .gitignore files")
+	visualizeCmd.Flags().StringVarP(&outputDir, "output-dir", "", "maze-output", "The folder for results, relative to the terraform directory")
+
+	visualizeCmd.SetOutput(color.Output)
+
+}